@@ -0,0 +1,389 @@
+// api/adspend.go
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type AdSpendEntry struct {
+	ID        int     `json:"id"`
+	StageID   *int    `json:"stage_id,omitempty"`
+	StageName *string `json:"stage_name,omitempty"`
+	Channel   string  `json:"channel"`
+	SpendDate string  `json:"spend_date"` // YYYY-MM-DD
+	Amount    float64 `json:"amount"`
+	Campaign  *string `json:"campaign,omitempty"`
+	ImportID  *int    `json:"import_id,omitempty"`
+	CreatedAt *string `json:"created_at,omitempty"`
+	Replaced  bool    `json:"replaced,omitempty"` // create overwrote an existing row
+}
+
+type AdSpendImportResult struct {
+	ImportID    int     `json:"import_id"`
+	Channel     string  `json:"channel"`
+	Rows        int     `json:"rows"`
+	Replaced    int     `json:"replaced"` // rows that overwrote an existing entry
+	TotalAmount float64 `json:"total_amount"`
+}
+
+// upsert on ad_spend_entries_uidx: the same stage/channel/day/campaign is
+// one ledger row, a later value replaces the earlier one
+const adSpendUpsert = `
+	INSERT INTO ad_spend_entries (stage_id, channel, spend_date, amount, campaign, import_id)
+	VALUES ($1, $2, $3::date, $4, NULLIF($5, ''), $6)
+	ON CONFLICT (channel, spend_date, (COALESCE(campaign, '')), (COALESCE(stage_id, 0)))
+	DO UPDATE SET amount = EXCLUDED.amount, import_id = EXCLUDED.import_id
+	RETURNING id, xmax <> 0` // xmax is set on the updated (replaced) row
+
+// GET /api/ad-spend?stage_id=&channel=&from=&to=
+func (h *Handler) ListAdSpend(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	stageID, _ := strconv.Atoi(q.Get("stage_id"))
+	channel := normalizeAdChannel(q.Get("channel"))
+	from, to, err := dateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT e.id, e.stage_id, s.name, e.channel, to_char(e.spend_date, 'YYYY-MM-DD'),
+		       e.amount, e.campaign, e.import_id,
+		       to_char(e.created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')
+		FROM ad_spend_entries e
+		LEFT JOIN stages s ON s.id = e.stage_id
+		WHERE ($1 = 0 OR e.stage_id = $1)
+		  AND ($2 = '' OR e.channel = $2)
+		  AND ($3 = '' OR e.spend_date >= NULLIF($3, '')::date)
+		  AND ($4 = '' OR e.spend_date <= NULLIF($4, '')::date)
+		ORDER BY e.spend_date DESC, e.id DESC`, stageID, channel, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []AdSpendEntry{}
+	for rows.Next() {
+		var e AdSpendEntry
+		if err := rows.Scan(&e.ID, &e.StageID, &e.StageName, &e.Channel, &e.SpendDate,
+			&e.Amount, &e.Campaign, &e.ImportID, &e.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+/*
+	POST /api/ad-spend
+
+Request-Body:
+
+	{
+	  "stage_id": 7,
+	  "channel": "meta",
+	  "spend_date": "2025-10-12",
+	  "amount": 184.30,
+	  "campaign": "Webinar Oktober – Retargeting"
+	}
+
+Stage, channel, day and campaign identify one ledger row: an existing row
+is replaced (200, "replaced": true), otherwise one is created (201).
+*/
+func (h *Handler) CreateAdSpend(w http.ResponseWriter, r *http.Request) {
+	var e AdSpendEntry
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e.Channel = normalizeAdChannel(e.Channel)
+	if e.Channel == "" {
+		http.Error(w, "channel is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse("2006-01-02", e.SpendDate); err != nil {
+		http.Error(w, "spend_date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if e.Amount < 0 {
+		http.Error(w, "amount must be >= 0", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.QueryRow(adSpendUpsert,
+		e.StageID, e.Channel, e.SpendDate, e.Amount, derefString(e.Campaign), nil,
+	).Scan(&e.ID, &e.Replaced); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if e.Replaced {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	_ = json.NewEncoder(w).Encode(e)
+}
+
+// DELETE /api/ad-spend/{id}
+func (h *Handler) DeleteAdSpend(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid ad spend id", http.StatusBadRequest)
+		return
+	}
+	res, err := h.DB.Exec(`DELETE FROM ad_spend_entries WHERE id = $1`, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "ad spend entry not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+	POST /api/ad-spend/import?channel=meta&stage_id=7
+
+Multipart field "file" or the raw CSV as body. Understands the daily
+spend exports of Meta Ads Manager and Google Ads (incl. YouTube) as well
+as a plain "date;channel;stage;campaign;amount" file. channel and stage
+can come from the query or from a column (stage by id or slug).
+*/
+func (h *Handler) ImportAdSpend(w http.ResponseWriter, r *http.Request) {
+	var data []byte
+	var filename *string
+	var err error
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, hdr, ferr := r.FormFile("file")
+		if ferr != nil {
+			http.Error(w, "file required: "+ferr.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		data, err = io.ReadAll(io.LimitReader(f, 10<<20))
+		filename = &hdr.Filename
+	} else {
+		data, err = io.ReadAll(io.LimitReader(r.Body, 10<<20))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "empty file", http.StatusBadRequest)
+		return
+	}
+
+	defaultChannel := normalizeAdChannel(r.FormValue("channel"))
+	var defaultStage *int
+	if v := r.FormValue("stage_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid stage id", http.StatusBadRequest)
+			return
+		}
+		defaultStage = &id
+	}
+
+	lines, err := parseAdSpendCSV(data, defaultChannel)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "begin tx: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// resolve stage columns (id or slug) once per distinct value
+	stageIDs := map[string]*int{}
+	for _, l := range lines {
+		if l.stage == "" {
+			continue
+		}
+		if _, ok := stageIDs[l.stage]; ok {
+			continue
+		}
+		var id int
+		err := tx.QueryRow(`
+			SELECT id FROM stages
+			WHERE id::text = $1 OR slug = $2`,
+			strings.TrimSpace(l.stage), slugify(l.stage),
+		).Scan(&id)
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("csv: unknown stage %q", l.stage), http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stageIDs[l.stage] = &id
+	}
+
+	channel := defaultChannel
+	if channel == "" {
+		channel = lines[0].channel
+	}
+	var importID int
+	if err := tx.QueryRow(
+		`INSERT INTO ad_spend_imports (filename, channel, rows) VALUES ($1, $2, $3) RETURNING id`,
+		filename, channel, len(lines),
+	).Scan(&importID); err != nil {
+		http.Error(w, "insert import: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := AdSpendImportResult{ImportID: importID, Channel: channel, Rows: len(lines)}
+	for _, l := range lines {
+		stageID := defaultStage
+		if l.stage != "" {
+			stageID = stageIDs[l.stage]
+		}
+		var id int
+		var replaced bool
+		if err := tx.QueryRow(adSpendUpsert,
+			stageID, l.channel, l.date, l.amount, l.campaign, importID,
+		).Scan(&id, &replaced); err != nil {
+			http.Error(w, "insert spend: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if replaced {
+			res.Replaced++
+		}
+		res.TotalAmount += l.amount
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+/* ------------ CSV ------------ */
+
+var adSpendColumns = map[string][]string{
+	"date":     {"date", "day", "tag", "datum", "reporting starts", "berichtsbeginn", "spend_date"},
+	"amount":   {"amount", "spend", "cost", "kosten", "amount spent (eur)", "amount spent", "ausgegebener betrag (eur)", "ausgegebener betrag", "betrag"},
+	"campaign": {"campaign", "campaign name", "kampagne", "kampagnenname", "name der kampagne"},
+	"channel":  {"channel", "platform", "kanal", "plattform"},
+	"stage":    {"stage", "stage_id", "stage_slug"},
+}
+
+type adSpendLine struct {
+	date, channel, stage, campaign string
+	amount                         float64
+}
+
+func parseAdSpendCSV(data []byte, defaultChannel string) ([]adSpendLine, error) {
+	records, idx, err := readAliasedCSV(data, adSpendColumns)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := idx["date"]; !ok {
+		return nil, errors.New("csv: no date column")
+	}
+	if _, ok := idx["amount"]; !ok {
+		return nil, errors.New("csv: no amount/cost column")
+	}
+
+	get := func(rec []string, col string) string {
+		i, ok := idx[col]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	amounts := make([]string, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		amounts = append(amounts, get(rec, "amount"))
+	}
+	dec := csvDecimalSep(amounts, csvComma(data))
+
+	// rows with the same key are summed (e.g. one line per ad set)
+	sums := map[adSpendLine]float64{}
+	var order []adSpendLine
+	for n, rec := range records[1:] {
+		if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+		first := strings.ToLower(strings.TrimSpace(rec[0]))
+		if strings.HasPrefix(first, "total") || strings.HasPrefix(first, "gesamt") {
+			continue // summary rows of Google Ads exports
+		}
+		date, err := parseLooseDate(strings.SplitN(get(rec, "date"), " ", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("csv row %d: %w", n+2, err)
+		}
+		amt, err := parseAmount(firstNonEmpty(get(rec, "amount"), "0"), dec)
+		if err != nil {
+			return nil, fmt.Errorf("csv row %d: %w", n+2, err)
+		}
+		if amt < 0 {
+			return nil, fmt.Errorf("csv row %d: negative amount", n+2)
+		}
+		key := adSpendLine{
+			date:     date,
+			channel:  firstNonEmpty(normalizeAdChannel(get(rec, "channel")), defaultChannel),
+			stage:    get(rec, "stage"),
+			campaign: get(rec, "campaign"),
+		}
+		if key.channel == "" {
+			return nil, fmt.Errorf("csv row %d: no channel (column or ?channel=)", n+2)
+		}
+		if _, ok := sums[key]; !ok {
+			order = append(order, key)
+		}
+		sums[key] += amt
+	}
+	if len(order) == 0 {
+		return nil, errors.New("csv: no data rows")
+	}
+
+	out := make([]adSpendLine, 0, len(order))
+	for _, k := range order {
+		k.amount = sums[k]
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+func normalizeAdChannel(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "facebook", "instagram", "meta ads", "facebook ads":
+		return "meta"
+	case "google ads", "adwords", "google_ads":
+		return "google"
+	case "yt", "youtube ads":
+		return "youtube"
+	}
+	return s
+}
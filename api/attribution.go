@@ -0,0 +1,326 @@
+// api/attribution.go
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Attribution models. A touch is every stage a client was in contact with
+// before the contract was signed: stage_client_assignments, linked
+// stage_participants and clients.source_stage_id.
+const (
+	ModelFirstTouch = "first_touch"
+	ModelLastTouch  = "last_touch"
+	ModelLinear     = "linear"
+	ModelTimeDecay  = "time_decay"
+)
+
+var attributionModels = []string{ModelFirstTouch, ModelLastTouch, ModelLinear, ModelTimeDecay}
+
+type StageAttribution struct {
+	StageID     int     `json:"stage_id"`
+	Name        string  `json:"name"`
+	Date        *string `json:"date,omitempty"`
+	Revenue     float64 `json:"revenue"`
+	Conversions float64 `json:"conversions"` // fractional contracts
+}
+
+type AttributionReport struct {
+	Model               string             `json:"model"`
+	HalfLifeDays        float64            `json:"half_life_days,omitempty"`
+	TotalRevenue        float64            `json:"total_revenue"`
+	UnattributedRevenue float64            `json:"unattributed_revenue"` // contracts without any touch
+	Stages              []StageAttribution `json:"stages"`
+}
+
+type StageAttributionComparison struct {
+	StageID int                         `json:"stage_id"`
+	Name    string                      `json:"name"`
+	Date    *string                     `json:"date,omitempty"`
+	Models  map[string]StageAttribution `json:"models"`
+}
+
+type attributionTouch struct {
+	stageID   int
+	touchedAt time.Time
+}
+
+type attributionContract struct {
+	id       int
+	revenue  float64
+	signedAt time.Time
+	touches  []attributionTouch // ordered by touchedAt
+}
+
+type stageInfo struct {
+	name string
+	date *string
+}
+
+// GET /api/attribution?model=linear&from=&to=&half_life_days=7
+// from/to filter contracts by start_date.
+func (h *Handler) GetAttribution(w http.ResponseWriter, r *http.Request) {
+	model := r.URL.Query().Get("model")
+	if model == "" {
+		model = ModelLinear
+	}
+	if !validAttributionModel(model) {
+		http.Error(w, "model must be one of first_touch, last_touch, linear, time_decay", http.StatusBadRequest)
+		return
+	}
+	from, to, err := dateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	halfLife := h.attributionHalfLife(r)
+
+	contracts, stages, err := h.loadAttributionData(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report := AttributionReport{Model: model, Stages: []StageAttribution{}}
+	if model == ModelTimeDecay {
+		report.HalfLifeDays = halfLife
+	}
+	byStage := map[int]*StageAttribution{}
+	for _, c := range contracts {
+		report.TotalRevenue += c.revenue
+		if len(c.touches) == 0 {
+			report.UnattributedRevenue += c.revenue
+			continue
+		}
+		for stageID, share := range attributeContract(c, model, halfLife) {
+			a, ok := byStage[stageID]
+			if !ok {
+				a = &StageAttribution{StageID: stageID, Name: stages[stageID].name, Date: stages[stageID].date}
+				byStage[stageID] = a
+			}
+			a.Revenue += share * c.revenue
+			a.Conversions += share
+		}
+	}
+	for _, a := range byStage {
+		report.Stages = append(report.Stages, *a)
+	}
+	sort.Slice(report.Stages, func(i, j int) bool {
+		return report.Stages[i].Revenue > report.Stages[j].Revenue ||
+			(report.Stages[i].Revenue == report.Stages[j].Revenue && report.Stages[i].StageID < report.Stages[j].StageID)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// GET /api/attribution/compare?from=&to=&half_life_days=7&stage_id=
+// All models side by side, one row per touched stage.
+func (h *Handler) CompareAttribution(w http.ResponseWriter, r *http.Request) {
+	onlyStage, _ := strconv.Atoi(r.URL.Query().Get("stage_id"))
+	from, to, err := dateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	halfLife := h.attributionHalfLife(r)
+
+	contracts, stages, err := h.loadAttributionData(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	byStage := map[int]*StageAttributionComparison{}
+	for _, c := range contracts {
+		if len(c.touches) == 0 {
+			continue
+		}
+		for _, model := range attributionModels {
+			for stageID, share := range attributeContract(c, model, halfLife) {
+				cmp, ok := byStage[stageID]
+				if !ok {
+					cmp = &StageAttributionComparison{
+						StageID: stageID,
+						Name:    stages[stageID].name,
+						Date:    stages[stageID].date,
+						Models:  map[string]StageAttribution{},
+					}
+					byStage[stageID] = cmp
+				}
+				a := cmp.Models[model]
+				a.StageID, a.Name, a.Date = stageID, cmp.Name, cmp.Date
+				a.Revenue += share * c.revenue
+				a.Conversions += share
+				cmp.Models[model] = a
+			}
+		}
+	}
+
+	out := []StageAttributionComparison{}
+	for _, cmp := range byStage {
+		if onlyStage != 0 && cmp.StageID != onlyStage {
+			continue
+		}
+		// every model appears, even with zero credit
+		for _, model := range attributionModels {
+			if _, ok := cmp.Models[model]; !ok {
+				cmp.Models[model] = StageAttribution{StageID: cmp.StageID, Name: cmp.Name, Date: cmp.Date}
+			}
+		}
+		out = append(out, *cmp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StageID < out[j].StageID })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func validAttributionModel(m string) bool {
+	for _, v := range attributionModels {
+		if v == m {
+			return true
+		}
+	}
+	return false
+}
+
+// attributionHalfLife: ?half_life_days= > app_settings attribution_half_life_days > 7.
+func (h *Handler) attributionHalfLife(r *http.Request) float64 {
+	if v, err := strconv.ParseFloat(r.URL.Query().Get("half_life_days"), 64); err == nil && v > 0 {
+		return v
+	}
+	if v := h.getNumericSetting("attribution_half_life_days", 7); v > 0 {
+		return v
+	}
+	return 7
+}
+
+// attributeContract returns each touched stage's share (summing to 1).
+// A stage touched more than once counts once, at its first touch.
+func attributeContract(c attributionContract, model string, halfLifeDays float64) map[int]float64 {
+	shares := map[int]float64{}
+	n := len(c.touches)
+	if n == 0 {
+		return shares
+	}
+	switch model {
+	case ModelFirstTouch:
+		shares[c.touches[0].stageID] = 1
+	case ModelLastTouch:
+		shares[c.touches[n-1].stageID] = 1
+	case ModelLinear:
+		for _, t := range c.touches {
+			shares[t.stageID] += 1 / float64(n)
+		}
+	case ModelTimeDecay:
+		// weight halves every halfLifeDays before signing, relative to the
+		// latest touch so the largest weight is 1 and years-old touches
+		// can't underflow every weight to 0
+		days := make([]float64, n)
+		minDays := math.Inf(1)
+		for i, t := range c.touches {
+			days[i] = math.Max(c.signedAt.Sub(t.touchedAt).Hours()/24, 0)
+			minDays = math.Min(minDays, days[i])
+		}
+		var total float64
+		weights := make([]float64, n)
+		for i := range c.touches {
+			weights[i] = math.Pow(2, -(days[i]-minDays)/halfLifeDays)
+			total += weights[i]
+		}
+		for i, t := range c.touches {
+			shares[t.stageID] += weights[i] / total
+		}
+	}
+	return shares
+}
+
+// loadAttributionData loads contracts (start_date within from/to) with
+// their touches before signing, plus the names of all touched stages.
+func (h *Handler) loadAttributionData(from, to string) ([]attributionContract, map[int]stageInfo, error) {
+	rows, err := h.DB.Query(`
+		WITH touches AS (
+			SELECT a.client_id, a.stage_id, COALESCE(s.date::timestamp, a.assigned_at) AS touched_at
+			FROM stage_client_assignments a
+			JOIN stages s ON s.id = a.stage_id
+			UNION ALL
+			SELECT p.linked_client_id, p.stage_id, COALESCE(s.date::timestamp, p.created_at)
+			FROM stage_participants p
+			JOIN stages s ON s.id = p.stage_id
+			WHERE p.linked_client_id IS NOT NULL
+			UNION ALL
+			SELECT cl.id, cl.source_stage_id, COALESCE(s.date::timestamp, cl.created_at)
+			FROM clients cl
+			JOIN stages s ON s.id = cl.source_stage_id
+		)
+		SELECT
+			c.id,
+			c.revenue_total,
+			COALESCE(c.created_at, c.start_date::timestamp) AS signed_at,
+			t.stage_id,
+			MIN(t.touched_at)
+		FROM contracts c
+		LEFT JOIN touches t
+		       ON t.client_id = c.client_id
+		      AND t.touched_at <= COALESCE(c.created_at, c.start_date::timestamp)
+		WHERE ($1 = '' OR c.start_date >= NULLIF($1, '')::date)
+		  AND ($2 = '' OR c.start_date <= NULLIF($2, '')::date)
+		GROUP BY c.id, c.revenue_total, signed_at, t.stage_id
+		ORDER BY c.id, MIN(t.touched_at), t.stage_id`, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var out []attributionContract
+	stageIDs := map[int]bool{}
+	for rows.Next() {
+		var (
+			id        int
+			revenue   float64
+			signedAt  time.Time
+			stageID   *int
+			touchedAt *time.Time
+		)
+		if err := rows.Scan(&id, &revenue, &signedAt, &stageID, &touchedAt); err != nil {
+			return nil, nil, err
+		}
+		if len(out) == 0 || out[len(out)-1].id != id {
+			out = append(out, attributionContract{id: id, revenue: revenue, signedAt: signedAt})
+		}
+		if stageID != nil && touchedAt != nil {
+			c := &out[len(out)-1]
+			c.touches = append(c.touches, attributionTouch{stageID: *stageID, touchedAt: *touchedAt})
+			stageIDs[*stageID] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	stages := map[int]stageInfo{}
+	if len(stageIDs) > 0 {
+		srows, err := h.DB.Query(`SELECT id, name, to_char(date, 'YYYY-MM-DD') FROM stages`)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer srows.Close()
+		for srows.Next() {
+			var id int
+			var si stageInfo
+			if err := srows.Scan(&id, &si.name, &si.date); err != nil {
+				return nil, nil, err
+			}
+			if stageIDs[id] {
+				stages[id] = si
+			}
+		}
+	}
+	return out, stages, nil
+}
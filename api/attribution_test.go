@@ -0,0 +1,69 @@
+package api
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAttributeContract(t *testing.T) {
+	signed := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	daysBefore := func(d int) time.Time { return signed.AddDate(0, 0, -d) }
+	c := attributionContract{
+		signedAt: signed,
+		touches: []attributionTouch{
+			{stageID: 1, touchedAt: daysBefore(14)},
+			{stageID: 2, touchedAt: daysBefore(7)},
+			{stageID: 3, touchedAt: daysBefore(0)},
+		},
+	}
+	tests := []struct {
+		model string
+		want  map[int]float64
+	}{
+		{ModelFirstTouch, map[int]float64{1: 1}},
+		{ModelLastTouch, map[int]float64{3: 1}},
+		{ModelLinear, map[int]float64{1: 1.0 / 3, 2: 1.0 / 3, 3: 1.0 / 3}},
+		// weights 1/4, 1/2, 1
+		{ModelTimeDecay, map[int]float64{1: 1.0 / 7, 2: 2.0 / 7, 3: 4.0 / 7}},
+	}
+	for _, tt := range tests {
+		got := attributeContract(c, tt.model, 7)
+		if !sharesEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.model, got, tt.want)
+		}
+	}
+
+	if got := attributeContract(attributionContract{signedAt: signed}, ModelTimeDecay, 7); len(got) != 0 {
+		t.Errorf("no touches: got %v", got)
+	}
+}
+
+func TestAttributeContractTimeDecayOldTouches(t *testing.T) {
+	// 2^-(days/half-life) is 0 for all of these; relative to the latest
+	// touch they still split 2:1
+	signed := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	c := attributionContract{
+		signedAt: signed,
+		touches: []attributionTouch{
+			{stageID: 1, touchedAt: signed.AddDate(-30, 0, -1)},
+			{stageID: 2, touchedAt: signed.AddDate(-30, 0, 0)},
+		},
+	}
+	got := attributeContract(c, ModelTimeDecay, 1)
+	if want := map[int]float64{1: 1.0 / 3, 2: 2.0 / 3}; !sharesEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func sharesEqual(a, b map[int]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range b {
+		if math.Abs(a[k]-v) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,327 @@
+// api/audit.go
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// auditEntity says how to snapshot the row a route changes.
+type auditEntity struct {
+	Type    string
+	Table   string
+	Key     string // key column
+	Param   string // URL param holding the key; "" for creates
+	IDField string // creates: response field with the new key
+}
+
+// Routes not listed here are still logged, without before/after.
+var auditEntities = map[string]auditEntity{
+	"/api/clients":                   {"client", "clients", "id", "", "id"},
+	"/api/clients/{id}/sepa-mandate": {"client", "clients", "id", "id", ""},
+	"/api/sales":                     {"sales_process", "sales_process", "id", "", "id"},
+	"/api/sales/start":               {"sales_process", "sales_process", "id", "", "sales_process_id"},
+	"/api/sales/{id}":                {"sales_process", "sales_process", "id", "id", ""},
+	"/api/contracts":                 {"contract", "contracts", "id", "", "id"},
+	"/api/contracts/{id}":            {"contract", "contracts", "id", "id", ""},
+	"/api/stages":                    {"stage", "stages", "id", "", "id"},
+	"/api/stages/{id}":               {"stage", "stages", "id", "id", ""},
+	"/api/stages/{id}/stats":         {"stage", "stages", "id", "id", ""},
+	"/api/stages/{id}/participants":  {"participant", "stage_participants", "id", "", "id"},
+	"/api/stages/{id}/participants/{participant_id}":         {"participant", "stage_participants", "id", "participant_id", ""},
+	"/api/stages/{id}/participants/{participant_id}/convert": {"participant", "stage_participants", "id", "participant_id", ""},
+	"/api/ad-spend":                          {"ad_spend", "ad_spend_entries", "id", "", "id"},
+	"/api/ad-spend/{id}":                     {"ad_spend", "ad_spend_entries", "id", "id", ""},
+	"/api/expenses":                          {"expense", "expenses", "id", "", "id"},
+	"/api/expenses/{id}":                     {"expense", "expenses", "id", "id", ""},
+	"/api/bank-imports/{id}/lines/{line_id}": {"bank_line", "bank_statement_lines", "id", "line_id", ""},
+	"/api/settings/{key}":                    {"setting", "app_settings", "key", "key", ""},
+	"/api/email/templates/{key}":             {"email_template", "email_templates", "key", "key", ""},
+	"/api/webhooks":                          {"webhook", "webhook_endpoints", "id", "", "id"},
+	"/api/webhooks/{id}":                     {"webhook", "webhook_endpoints", "id", "id", ""},
+	"/api/admin/users":                       {"user", "users", "id", "", "id"},
+	"/api/admin/users/{id}":                  {"user", "users", "id", "id", ""},
+	"/api/admin/users/{id}/disable":          {"user", "users", "id", "id", ""},
+	"/api/admin/users/{id}/enable":           {"user", "users", "id", "id", ""},
+}
+
+// never written to the log
+var auditRedacted = map[string]bool{"secret": true, "token_hash": true}
+
+// diff values of these change on every write and say nothing
+var auditIgnored = map[string]bool{"updated_at": true}
+
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	CreatedAt  string          `json:"created_at"`
+	ActorEmail *string         `json:"actor_email,omitempty"`
+	IP         *string         `json:"ip,omitempty"`
+	Method     string          `json:"method"`
+	Route      string          `json:"route"`
+	Path       string          `json:"path"`
+	Status     int             `json:"status"`
+	EntityType *string         `json:"entity_type,omitempty"`
+	EntityID   *string         `json:"entity_id,omitempty"`
+	Changes    json.RawMessage `json:"changes,omitempty"`
+}
+
+type auditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// auditRecorder passes the response through and keeps status and body.
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+const auditMaxBody = 64 << 10
+
+func (a *auditRecorder) WriteHeader(code int) {
+	if a.status == 0 {
+		a.status = code
+	}
+	a.ResponseWriter.WriteHeader(code)
+}
+
+func (a *auditRecorder) Write(b []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+	if a.body.Len() < auditMaxBody {
+		a.body.Write(b)
+	}
+	return a.ResponseWriter.Write(b)
+}
+
+// AuditLog records every successful POST/PUT/PATCH/DELETE. routes is the
+// root router, used to resolve the route pattern before the handler runs.
+// Must run after RequireAuth.
+func (h *Handler) AuditLog(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rctx := chi.NewRouteContext()
+			pattern := routes.Find(rctx, r.Method, r.URL.Path)
+			if pattern == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ent, known := auditEntities[pattern]
+			var entityID string
+			var before map[string]any
+			if known && ent.Param != "" {
+				entityID = rctx.URLParam(ent.Param)
+				before = h.auditSnapshot(ent, entityID)
+			}
+
+			rec := &auditRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status < 200 || rec.status >= 300 {
+				return
+			}
+
+			entry := AuditEntry{
+				Method: r.Method,
+				Route:  pattern,
+				Path:   r.URL.Path,
+				Status: rec.status,
+			}
+			if sess := currentSession(r); sess != nil {
+				entry.ActorEmail = &sess.Email
+			}
+			ip := h.clientIP(r)
+			entry.IP = &ip
+
+			if known {
+				if ent.IDField != "" {
+					var resp map[string]any
+					if json.Unmarshal(rec.body.Bytes(), &resp) == nil {
+						if v, ok := resp[ent.IDField]; ok && v != nil {
+							entityID = fmt.Sprint(v)
+						}
+					}
+				}
+				// nil after a delete; a DELETE on a sub-resource (sepa-mandate)
+				// still leaves the row
+				var after map[string]any
+				if entityID != "" {
+					after = h.auditSnapshot(ent, entityID)
+				}
+				entry.EntityType = &ent.Type
+				if changes := auditDiff(before, after); len(changes) > 0 {
+					entry.Changes, _ = json.Marshal(changes)
+				}
+			} else {
+				// e.g. /api/dunning/run -> "dunning", {id} if the route has one
+				area, _, _ := strings.Cut(strings.TrimPrefix(pattern, "/api/"), "/")
+				entry.EntityType = &area
+				entityID = rctx.URLParam("id")
+			}
+			if entityID != "" {
+				entry.EntityID = &entityID
+			}
+
+			if err := h.writeAudit(entry); err != nil {
+				log.Printf("audit: %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		})
+	}
+}
+
+func (h *Handler) auditSnapshot(ent auditEntity, id string) map[string]any {
+	// compare in the key's own type so its index is used; "id" keys are
+	// SERIAL, the others (settings, templates) text
+	keyType := "text"
+	if ent.Key == "id" {
+		if _, err := strconv.Atoi(id); err != nil {
+			return nil
+		}
+		keyType = "int"
+	}
+	var raw []byte
+	// table and key come from auditEntities, never from the request
+	err := h.DB.QueryRow(fmt.Sprintf(
+		`SELECT to_jsonb(t) FROM %s t WHERE t.%s = $1::%s`, ent.Table, ent.Key, keyType), id,
+	).Scan(&raw)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if json.Unmarshal(raw, &m) != nil {
+		return nil
+	}
+	for k := range m {
+		if auditRedacted[k] {
+			m[k] = "[redacted]"
+		}
+	}
+	return m
+}
+
+// auditDiff lists the fields that differ; a create has before == nil, a
+// delete after == nil.
+func auditDiff(before, after map[string]any) map[string]auditChange {
+	out := map[string]auditChange{}
+	for k, b := range before {
+		if a, ok := after[k]; auditIgnored[k] || (ok && reflect.DeepEqual(a, b)) {
+			continue
+		}
+		out[k] = auditChange{Before: b, After: after[k]}
+	}
+	for k, a := range after {
+		if _, ok := before[k]; ok || auditIgnored[k] {
+			continue
+		}
+		out[k] = auditChange{After: a}
+	}
+	return out
+}
+
+func (h *Handler) writeAudit(e AuditEntry) error {
+	_, err := h.DB.Exec(`
+		INSERT INTO audit_log (actor_email, ip, method, route, path, status, entity_type, entity_id, changes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, '')::jsonb)`,
+		e.ActorEmail, e.IP, e.Method, e.Route, e.Path, e.Status, e.EntityType, e.EntityID, string(e.Changes))
+	return err
+}
+
+// GET /api/audit?entity_type=client&entity_id=12&actor=anna@example.com&route=&from=YYYY-MM-DD&to=YYYY-MM-DD&before_id=&limit=100
+// Newest first; page with before_id = last id of the previous page.
+func (h *Handler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to, err := dateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > 1000 {
+			http.Error(w, "limit must be 1..1000", http.StatusBadRequest)
+			return
+		}
+	}
+	beforeID, _ := strconv.ParseInt(q.Get("before_id"), 10, 64)
+
+	rows, err := h.DB.Query(`
+		SELECT id, to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ'), actor_email, ip,
+		       method, route, path, status, entity_type, entity_id, changes
+		FROM audit_log
+		WHERE ($1 = '' OR entity_type = $1)
+		  AND ($2 = '' OR entity_id = $2)
+		  AND ($3 = '' OR lower(actor_email) = lower($3))
+		  AND ($4 = '' OR route = $4)
+		  AND (NULLIF($5, '')::date IS NULL OR created_at >= NULLIF($5, '')::date)
+		  AND (NULLIF($6, '')::date IS NULL OR created_at < NULLIF($6, '')::date + 1)
+		  AND ($7 = 0 OR id < $7)
+		ORDER BY id DESC
+		LIMIT $8`,
+		q.Get("entity_type"), q.Get("entity_id"), q.Get("actor"), q.Get("route"), from, to, beforeID, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var changes []byte
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.ActorEmail, &e.IP, &e.Method, &e.Route, &e.Path,
+			&e.Status, &e.EntityType, &e.EntityID, &changes); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		e.Changes = changes
+		out = append(out, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// StartAuditPruner deletes entries older than app_settings
+// audit_retention_days (default 365, 0 keeps everything) once a day.
+func (h *Handler) StartAuditPruner(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(24 * time.Hour)
+		defer t.Stop()
+		for {
+			if days := h.getNumericSetting("audit_retention_days", 365); days > 0 {
+				res, err := h.DB.ExecContext(ctx, `
+					DELETE FROM audit_log
+					WHERE created_at < now() - $1 * interval '1 day'`, days)
+				if err != nil {
+					log.Printf("audit: prune: %v", err)
+				} else if n, _ := res.RowsAffected(); n > 0 {
+					log.Printf("audit: pruned %d entries older than %.0f days", n, days)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
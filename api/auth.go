@@ -5,64 +5,82 @@ import (
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/idtoken"
 )
 
 type Session struct {
+	ID    string    `json:"id"`
 	Email string    `json:"email"`
 	Name  string    `json:"name"`
-	Exp   time.Time `json:"exp"`
+	Role  string    `json:"role"` // from users, so changes apply immediately
+	Exp   time.Time `json:"exp"`  // idle deadline, capped by the absolute expiry
+
+	// set when authenticated by a personal API token instead of the cookie
+	TokenID int      `json:"-"`
+	Scopes  []string `json:"scopes,omitempty"`
+
+	lastSeen  time.Time
+	expiresAt time.Time
 }
 
 type Auth struct {
-	OAuth      *oauth2.Config
-	Allowed    map[string]bool
+	Providers  map[string]*OIDCProvider // by name, see OIDCProviderConfig
 	CookieName string
-	CookieKey  []byte
+	CookieKeys [][]byte // first one signs, all verify (key rotation)
 }
 
 func (h *Handler) InitAuth() error {
-	allowed := map[string]bool{}
-	for _, e := range strings.Split(os.Getenv("ALLOWED_EMAILS"), ",") {
-		e = strings.ToLower(strings.TrimSpace(e))
-		if e != "" {
-			allowed[e] = true
+	signingKey := h.Cfg.CookieSigningKey
+	if signingKey == "" && h.isLocal() {
+		// sessions just don't survive a restart locally
+		signingKey = randHex(32)
+		log.Printf("auth: no COOKIE_SIGNING_KEY, using a random key (APP_ENV=local)")
+	}
+	keys := [][]byte{[]byte(signingKey)}
+	for _, k := range h.Cfg.OldSigningKeys {
+		keys = append(keys, []byte(k))
+	}
+	for _, k := range keys {
+		if len(k) < 32 {
+			return errors.New("COOKIE_SIGNING_KEY and COOKIE_SIGNING_KEYS_OLD must be >=32 bytes")
 		}
 	}
-	key := []byte(os.Getenv("COOKIE_SIGNING_KEY"))
-	if len(key) < 32 {
-		return errors.New("COOKIE_SIGNING_KEY must be >=32 bytes")
+	providers := map[string]*OIDCProvider{}
+	for _, pc := range h.Cfg.OIDCProviders {
+		providers[pc.Name] = NewOIDCProvider(pc)
 	}
 	h.Auth = &Auth{
-		OAuth: &oauth2.Config{
-			ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-			RedirectURL:  os.Getenv("OAUTH_REDIRECT_URL"), // <- must be FRONTEND origin + /auth/google/callback
-			Scopes:       []string{"openid", "email", "profile"},
-			Endpoint:     google.Endpoint,
-		},
-		Allowed:    allowed,
+		Providers:  providers,
 		CookieName: "app_session",
-		CookieKey:  key,
+		CookieKeys: keys,
 	}
 	return nil
 }
 
 func (a *Auth) sign(b []byte) string {
-	h := hmac.New(sha256.New, a.CookieKey)
+	return hmacSign(a.CookieKeys[0], b)
+}
+
+// hmacSign returns the base64url HMAC-SHA256 of b; shared by session
+// cookies and outbound webhook signatures.
+func hmacSign(key, b []byte) string {
+	h := hmac.New(sha256.New, key)
 	h.Write(b)
 	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
 }
@@ -84,10 +102,10 @@ func isSecure(r *http.Request) bool {
 	return false
 }
 
-func (a *Auth) makeCookie(sess Session, secure bool) *http.Cookie {
-	payload, _ := json.Marshal(sess)
-	enc := base64.RawURLEncoding.EncodeToString(payload)
-	token := enc + "." + a.sign([]byte(enc))
+// makeCookie carries only the signed session id; the session itself lives
+// in the sessions table.
+func (a *Auth) makeCookie(sessionID string, exp time.Time, secure bool) *http.Cookie {
+	token := sessionID + "." + a.sign([]byte(sessionID))
 	return &http.Cookie{
 		Name:     a.CookieName,
 		Value:    token,
@@ -95,7 +113,7 @@ func (a *Auth) makeCookie(sess Session, secure bool) *http.Cookie {
 		HttpOnly: true,
 		Secure:   secure,               // ⬅️ no longer hardcoded true
 		SameSite: http.SameSiteLaxMode, // first-party
-		Expires:  sess.Exp,
+		Expires:  exp,
 	}
 }
 
@@ -108,23 +126,52 @@ func randState() string {
 // --- Routes mounting ---
 
 func (h *Handler) MountAuthRoutes(r chi.Router) {
-	r.Get("/auth/google", h.handleAuthStart)
-	r.Get("/auth/google/callback", h.handleAuthCallback)
-	r.Get("/api/me", h.meHandler)
+	r.Get("/auth/providers", h.listAuthProviders)
+	r.Get("/auth/{provider}", h.handleAuthStart)
+	r.Get("/auth/{provider}/callback", h.handleAuthCallback)
 
-	// allow both; same handler
-	r.MethodFunc(http.MethodGet, "/auth/logout", h.handleLogout)
-	r.MethodFunc(http.MethodPost, "/auth/logout", h.handleLogout)
+	// POST only: it needs the CSRF token, a GET could be triggered by any site
+	r.Post("/auth/logout", h.handleLogout)
 
 	r.Get("/api/me", h.meHandler)
+}
 
+// authProvider resolves the {provider} URL segment.
+func (h *Handler) authProvider(w http.ResponseWriter, r *http.Request) (*OIDCProvider, bool) {
+	p, ok := h.Auth.Providers[chi.URLParam(r, "provider")]
+	if !ok {
+		http.Error(w, "unknown login provider", http.StatusNotFound)
+	}
+	return p, ok
 }
 
 // --- Handlers ---
 
+// GET /auth/providers - names for the login screen buttons
+func (h *Handler) listAuthProviders(w http.ResponseWriter, r *http.Request) {
+	out := []string{}
+	for name := range h.Auth.Providers {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
 func (h *Handler) handleAuthStart(w http.ResponseWriter, r *http.Request) {
 	log.Printf("handleAuthStart: query redirect=%q remote=%s\n", r.URL.Query().Get("redirect"), r.RemoteAddr)
 
+	provider, ok := h.authProvider(w, r)
+	if !ok {
+		return
+	}
+	oc, err := provider.OAuth2(r.Context())
+	if err != nil {
+		log.Printf("handleAuthStart: %v", err)
+		http.Error(w, "login provider unavailable", http.StatusBadGateway)
+		return
+	}
+
 	state := randState()
 	secure := isSecure(r)
 	sameSite := http.SameSiteLaxMode
@@ -142,116 +189,207 @@ func (h *Handler) handleAuthStart(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
+	// state (CSRF), nonce (ID token replay) and the PKCE verifier live in
+	// HttpOnly cookies until the callback
+	nonce := randState()
+	verifier := oauth2.GenerateVerifier()
+	setAuthFlowCookie(w, "oauth_state", state, secure)
+	setAuthFlowCookie(w, "oauth_nonce", nonce, secure)
+	setAuthFlowCookie(w, "oauth_pkce", verifier, secure)
+
+	if redirect := r.URL.Query().Get("redirect"); redirect != "" {
+		if h.allowedRedirect(redirect) {
+			setAuthFlowCookie(w, "post_login_redirect", redirect, secure)
+		} else {
+			log.Printf("handleAuthStart: ignoring redirect %q (not a configured origin)", redirect)
+		}
+	}
+
+	http.Redirect(w, r, oc.AuthCodeURL(state,
+		oauth2.AccessTypeOnline,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("nonce", nonce),
+	), http.StatusFound)
+}
+
+// authFlowCookies only live for one login round trip.
+var authFlowCookies = []string{"oauth_state", "oauth_nonce", "oauth_pkce", "post_login_redirect"}
+
+func setAuthFlowCookie(w http.ResponseWriter, name, value string, secure bool) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     "oauth_state",
-		Value:    state,
+		Name:     name,
+		Value:    value,
 		Path:     "/",
-		HttpOnly: false,
+		HttpOnly: true,
 		Secure:   secure,
-		SameSite: sameSite,
+		SameSite: http.SameSiteLaxMode,
 		Expires:  time.Now().Add(10 * time.Minute),
 	})
+}
 
-	if redirect := r.URL.Query().Get("redirect"); redirect != "" {
+func clearAuthFlowCookies(w http.ResponseWriter, secure bool) {
+	for _, name := range authFlowCookies {
 		http.SetCookie(w, &http.Cookie{
-			Name:     "post_login_redirect",
-			Value:    redirect,
+			Name:     name,
+			Value:    "",
 			Path:     "/",
 			HttpOnly: true,
 			Secure:   secure,
-			SameSite: sameSite,
-			Expires:  time.Now().Add(10 * time.Minute),
+			SameSite: http.SameSiteLaxMode,
+			Expires:  time.Unix(0, 0),
+			MaxAge:   -1,
 		})
 	}
+}
 
-	http.Redirect(w, r, h.Auth.OAuth.AuthCodeURL(state, oauth2.AccessTypeOnline), http.StatusFound)
+// allowedRedirect accepts same-site paths ("/x", not "//host") and URLs on
+// a configured frontend origin (CORS_ORIGINS, POST_LOGIN_REDIRECT).
+// Control characters are refused: browsers drop tabs and newlines, so
+// "/\t/evil.com" would become "//evil.com".
+func (h *Handler) allowedRedirect(target string) bool {
+	if strings.IndexFunc(target, func(c rune) bool { return c < 0x20 || c == 0x7f }) >= 0 {
+		return false
+	}
+	if strings.HasPrefix(target, "/") {
+		return !strings.HasPrefix(target, "//") && !strings.HasPrefix(target, "/\\")
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return false
+	}
+	origin := u.Scheme + "://" + u.Host
+	allowed := h.corsOrigins()
+	if pl, err := url.Parse(h.Cfg.PostLoginRedirect); err == nil && pl.Host != "" {
+		allowed = append(allowed, pl.Scheme+"://"+pl.Host)
+	}
+	for _, o := range allowed {
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsOrigins are the frontend origins allowed to call the API.
+func (h *Handler) corsOrigins() []string {
+	if len(h.Cfg.CORSOrigins) == 0 {
+		return []string{"http://localhost:5002"}
+	}
+	return append([]string(nil), h.Cfg.CORSOrigins...)
 }
 
 func (h *Handler) handleAuthCallback(w http.ResponseWriter, r *http.Request) {
-	log.Printf("handleAuthCallback: host=%q xf-host=%q proto=%q rawQuery=%q remote=%s",
-		r.Host, r.Header.Get("X-Forwarded-Host"), r.Header.Get("X-Forwarded-Proto"), r.URL.RawQuery, r.RemoteAddr)
+	log.Printf("handleAuthCallback: host=%q xf-host=%q proto=%q remote=%s",
+		r.Host, r.Header.Get("X-Forwarded-Host"), r.Header.Get("X-Forwarded-Proto"), r.RemoteAddr)
 
+	provider, ok := h.authProvider(w, r)
+	if !ok {
+		return
+	}
 	secure := isSecure(r)
-	sameSite := http.SameSiteLaxMode
 
 	// --- CSRF state check
 	state := r.URL.Query().Get("state")
 	stateC, _ := r.Cookie("oauth_state")
-	if state == "" || stateC == nil || state != stateC.Value {
+	nonceC, _ := r.Cookie("oauth_nonce")
+	pkceC, _ := r.Cookie("oauth_pkce")
+	if state == "" || stateC == nil || subtle.ConstantTimeCompare([]byte(state), []byte(stateC.Value)) != 1 ||
+		nonceC == nil || nonceC.Value == "" || pkceC == nil || pkceC.Value == "" {
 		http.Error(w, "invalid state", http.StatusBadRequest)
 		return
 	}
+	redirectC, _ := r.Cookie("post_login_redirect")
+	clearAuthFlowCookies(w, secure)
 
-	// --- Exchange code
+	// --- Exchange code (PKCE)
 	code := r.URL.Query().Get("code")
-	tok, err := h.Auth.OAuth.Exchange(r.Context(), code)
+	tok, err := provider.Exchange(r.Context(), code, oauth2.VerifierOption(pkceC.Value))
 	if err != nil {
 		http.Error(w, "exchange failed", http.StatusUnauthorized)
 		return
 	}
 
-	// --- Verify ID token
+	// --- Verify ID token (incl. nonce)
 	rawID, _ := tok.Extra("id_token").(string)
-	payload, err := idtoken.Validate(r.Context(), rawID, h.Auth.OAuth.ClientID)
+	claims, err := provider.VerifyIDToken(r.Context(), rawID, nonceC.Value)
 	if err != nil {
+		log.Printf("handleAuthCallback: %s: %v", provider.Name, err)
 		http.Error(w, "id token invalid", http.StatusUnauthorized)
 		return
 	}
 
-	email, _ := payload.Claims["email"].(string)
-	name, _ := payload.Claims["name"].(string)
-	verified, _ := payload.Claims["email_verified"].(bool)
-	email = strings.ToLower(strings.TrimSpace(email))
-	if !verified || !h.Auth.Allowed[email] {
+	email, name, err := provider.Identity(claims)
+	if err != nil {
+		log.Printf("handleAuthCallback: %s: %v", provider.Name, err)
 		http.Error(w, "access denied", http.StatusForbidden)
 		return
 	}
+	iss, _ := claims["iss"].(string)
+	sub, _ := claims["sub"].(string)
+	userID, err := h.loginOIDCUser(provider.Name, iss, sub, email, name)
+	if err == sql.ErrNoRows {
+		// not invited or disabled
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+	if err == errIdentityConflict {
+		log.Printf("handleAuthCallback: %s: %s signed in as %s from another account", provider.Name, sub, email)
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "user lookup failed", http.StatusInternalServerError)
+		return
+	}
 
 	// --- Issue session cookie (host-only on FRONTEND origin)
-	ck := h.Auth.makeCookie(Session{
-		Email: email,
-		Name:  name,
-		Exp:   time.Now().Add(12 * time.Hour),
-	}, secure)
-	http.SetCookie(w, ck)
-
-	// --- Decide final redirect target
-	redirectTo := os.Getenv("POST_LOGIN_REDIRECT")
+	if err := h.startSession(w, r, userID); err != nil {
+		http.Error(w, "session failed", http.StatusInternalServerError)
+		return
+	}
+
+	// --- Decide final redirect target (checked again, the cookie is client input)
+	redirectTo := h.Cfg.PostLoginRedirect
 	if redirectTo == "" {
 		redirectTo = "/"
 	}
-	if rc, err := r.Cookie("post_login_redirect"); err == nil && rc.Value != "" {
-		redirectTo = rc.Value
-		// clear helper cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "post_login_redirect",
-			Value:    "",
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   secure,
-			SameSite: sameSite,
-			Expires:  time.Unix(0, 0),
-			MaxAge:   -1,
-		})
+	if redirectC != nil && redirectC.Value != "" && h.allowedRedirect(redirectC.Value) {
+		redirectTo = redirectC.Value
 	}
+	writeRedirectPage(w, redirectTo)
+}
 
-	// --- Return HTML that forces a client-side redirect (more reliable behind CDNs)
+// writeRedirectPage returns HTML that forces a client-side redirect (more
+// reliable behind CDNs). target is escaped for both the attribute and the
+// script.
+func writeRedirectPage(w http.ResponseWriter, target string) {
+	js, _ := json.Marshal(target) // escapes <, > and & as \u003c etc.
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-store")
 	_, _ = w.Write([]byte(fmt.Sprintf(
 		`<!doctype html>
 <meta charset="utf-8">
 <title>Signing you in…</title>
-<meta http-equiv="refresh" content="0;url=%[1]s">
+<meta http-equiv="refresh" content="0;url=%s">
 <script>
   // Double attempt in case a proxy caches the first load
-  try { window.location.replace(%q); } catch (_) { window.location.href = %q; }
+  try { window.location.replace(%s); } catch (_) { window.location.href = %s; }
 </script>`,
-		redirectTo, redirectTo, redirectTo,
+		html.EscapeString(target), js, js,
 	)))
 }
 
+// POST /auth/logout with X-CSRF-Token, like every other write of a cookie
+// session. Without a valid session cookie it just clears the cookies.
 func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if id, ok := h.Auth.sessionID(r); ok {
+		if !h.Auth.validCSRF(id, r.Header.Get(csrfHeader)) {
+			http.Error(w, "invalid csrf token", http.StatusForbidden)
+			return
+		}
+		_, _ = h.DB.Exec(`UPDATE sessions SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+	}
+
 	expired := time.Unix(0, 0)
 	secure := isSecure(r)
 
@@ -272,26 +410,8 @@ func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
 	wipe(http.SameSiteNoneMode)
 
 	// helper cookies
-	for _, name := range []string{"oauth_state", "post_login_redirect"} {
-		http.SetCookie(w, &http.Cookie{
-			Name:     name,
-			Value:    "",
-			Path:     "/",
-			HttpOnly: name != "oauth_state",
-			Secure:   secure,
-			SameSite: http.SameSiteLaxMode,
-			Expires:  expired,
-			MaxAge:   -1,
-		})
-	}
+	clearAuthFlowCookies(w, secure)
 
-	// If browser navigated via GET → send them to the SPA login screen.
-	if r.Method == http.MethodGet {
-		http.Redirect(w, r, "/login?auth=logged_out", http.StatusFound)
-		return
-	}
-
-	// XHR POST case → return JSON
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte(`{"ok":true}`))
@@ -303,6 +423,7 @@ func (h *Handler) meHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	h.touchSession(w, r, sess)
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(sess)
 }
@@ -313,38 +434,26 @@ func (h *Handler) RequireAuth(next http.Handler) http.Handler {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
-		if _, ok := h.parseSession(r); !ok {
+		if token, ok := bearerToken(r); ok {
+			sess, ok := h.tokenSession(token)
+			if !ok {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withSession(r.Context(), sess)))
+			return
+		}
+
+		sess, ok := h.parseSession(r)
+		if !ok {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
-		next.ServeHTTP(w, r)
+		if csrfProtected(r.Method) && !h.Auth.validCSRF(sess.ID, r.Header.Get(csrfHeader)) {
+			http.Error(w, "invalid csrf token", http.StatusForbidden)
+			return
+		}
+		h.touchSession(w, r, sess)
+		next.ServeHTTP(w, r.WithContext(withSession(r.Context(), sess)))
 	})
 }
-
-func (h *Handler) parseSession(r *http.Request) (*Session, bool) {
-	if h == nil || h.Auth == nil || h.Auth.CookieName == "" {
-		return nil, false
-	}
-	c, err := r.Cookie(h.Auth.CookieName)
-	if err != nil {
-		return nil, false
-	}
-	parts := strings.Split(c.Value, ".")
-	if len(parts) != 2 {
-		return nil, false
-	}
-	mac := hmac.New(sha256.New, h.Auth.CookieKey)
-	mac.Write([]byte(parts[0]))
-	if base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) != parts[1] {
-		return nil, false
-	}
-	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
-	if err != nil {
-		return nil, false
-	}
-	var s Session
-	if json.Unmarshal(raw, &s) != nil || time.Now().After(s.Exp) {
-		return nil, false
-	}
-	return &s, true
-}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/oauth2"
+)
+
+func TestAllowedRedirect(t *testing.T) {
+	h := &Handler{Cfg: &Config{
+		CORSOrigins:       []string{"https://app.example.com"},
+		PostLoginRedirect: "https://crm.example.com/dashboard",
+	}}
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"/", true},
+		{"/clients?id=4", true},
+		{"https://app.example.com/clients", true},
+		{"https://APP.example.com", true},
+		{"https://crm.example.com/other", true},
+		{"//evil.com", false},
+		{"/\\evil.com", false},
+		{"/\t/evil.com", false},
+		{"/\n/evil.com", false},
+		{"https://app.example.com.evil.com", false},
+		{"https://app.example.com@evil.com", false},
+		{"https://evil.com/https://app.example.com", false},
+		{"http://app.example.com", false},
+		{"javascript:alert(1)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"ftp://app.example.com", false},
+		{"evil.com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := h.allowedRedirect(tt.target); got != tt.want {
+			t.Errorf("allowedRedirect(%q) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
+
+// authTestServer routes /auth/* of a handler whose only provider is f.
+func authTestServer(t *testing.T, f *fakeIssuer) http.Handler {
+	t.Helper()
+	h := &Handler{
+		Cfg: &Config{CORSOrigins: []string{"https://app.example.com"}},
+		Auth: &Auth{
+			Providers:  map[string]*OIDCProvider{"fake": f.provider()},
+			CookieName: "app_session",
+			CookieKeys: [][]byte{[]byte(strings.Repeat("k", 32))},
+		},
+	}
+	r := chi.NewRouter()
+	h.MountAuthRoutes(r)
+	return r
+}
+
+func TestAuthStartRedirectCookie(t *testing.T) {
+	srv := authTestServer(t, newFakeIssuer(t))
+	for target, want := range map[string]bool{
+		"/clients":                         true,
+		"https://app.example.com/x":        true,
+		"//evil.com":                       false,
+		"/\\evil.com":                      false,
+		"https://app.example.com.evil.com": false,
+		"javascript:alert(1)":              false,
+	} {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/fake?redirect="+url.QueryEscape(target), nil))
+		if rec.Code != http.StatusFound {
+			t.Fatalf("start: status %d: %s", rec.Code, rec.Body)
+		}
+		var got string
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "post_login_redirect" {
+				got = c.Value
+			}
+		}
+		if (got == target) != want || (!want && got != "") {
+			t.Errorf("redirect %q: post_login_redirect cookie = %q", target, got)
+		}
+	}
+}
+
+func TestAuthCallbackRejects(t *testing.T) {
+	f := newFakeIssuer(t)
+	srv := authTestServer(t, f)
+	verifier := oauth2.GenerateVerifier()
+	f.issueCode("code-1", verifier, f.sign(t, f.claims("nonce-1")))
+
+	tests := []struct {
+		name     string
+		state    string
+		cookies  map[string]string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "state mismatch",
+			state:    "state-2",
+			cookies:  map[string]string{"oauth_state": "state-1", "oauth_nonce": "nonce-1", "oauth_pkce": verifier},
+			wantCode: http.StatusBadRequest,
+			wantBody: "invalid state",
+		},
+		{
+			name:     "no state cookie",
+			state:    "state-1",
+			cookies:  map[string]string{"oauth_nonce": "nonce-1", "oauth_pkce": verifier},
+			wantCode: http.StatusBadRequest,
+			wantBody: "invalid state",
+		},
+		{
+			name:     "no nonce cookie",
+			state:    "state-1",
+			cookies:  map[string]string{"oauth_state": "state-1", "oauth_pkce": verifier},
+			wantCode: http.StatusBadRequest,
+			wantBody: "invalid state",
+		},
+		{
+			name:     "no PKCE cookie",
+			state:    "state-1",
+			cookies:  map[string]string{"oauth_state": "state-1", "oauth_nonce": "nonce-1"},
+			wantCode: http.StatusBadRequest,
+			wantBody: "invalid state",
+		},
+		{
+			name:     "PKCE verifier mismatch",
+			state:    "state-1",
+			cookies:  map[string]string{"oauth_state": "state-1", "oauth_nonce": "nonce-1", "oauth_pkce": oauth2.GenerateVerifier()},
+			wantCode: http.StatusUnauthorized,
+			wantBody: "exchange failed",
+		},
+		{
+			name:     "nonce mismatch",
+			state:    "state-1",
+			cookies:  map[string]string{"oauth_state": "state-1", "oauth_nonce": "nonce-2", "oauth_pkce": verifier},
+			wantCode: http.StatusUnauthorized,
+			wantBody: "id token invalid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/auth/fake/callback?code=code-1&state="+tt.state, nil)
+			for name, value := range tt.cookies {
+				req.AddCookie(&http.Cookie{Name: name, Value: value})
+			}
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Fatalf("status %d %q, want %d %q", rec.Code, rec.Body, tt.wantCode, tt.wantBody)
+			}
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == "app_session" {
+					t.Fatal("session cookie issued")
+				}
+			}
+		})
+	}
+}
+
+func TestWriteRedirectPageEscapes(t *testing.T) {
+	target := `/x"><script>alert(1)</script>';alert(2);//&`
+	rec := httptest.NewRecorder()
+	writeRedirectPage(rec, target)
+	body := rec.Body.String()
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if strings.Count(body, "<script>") != 1 || strings.Count(body, "</script>") != 1 {
+		t.Errorf("target broke out of the page:\n%s", body)
+	}
+	if strings.Contains(body, `"><`) {
+		t.Errorf("target not escaped:\n%s", body)
+	}
+	if !strings.Contains(body, `url=/x&#34;&gt;&lt;script&gt;`) {
+		t.Errorf("meta refresh not HTML-escaped:\n%s", body)
+	}
+	if !strings.Contains(body, `"/x\"\u003e\u003cscript\u003e`) {
+		t.Errorf("script target not JS-escaped:\n%s", body)
+	}
+}
+
+func TestLogoutRequiresCSRF(t *testing.T) {
+	srv := authTestServer(t, newFakeIssuer(t))
+	auth := &Auth{CookieName: "app_session", CookieKeys: [][]byte{[]byte(strings.Repeat("k", 32))}}
+	session := &http.Cookie{Name: "app_session", Value: "sess-1." + auth.sign([]byte("sess-1"))}
+
+	tests := []struct {
+		name     string
+		method   string
+		cookie   *http.Cookie
+		token    string
+		wantCode int
+	}{
+		{"GET does not log out", http.MethodGet, session, "", http.StatusNotFound},
+		{"no token", http.MethodPost, session, "", http.StatusForbidden},
+		{"token of another session", http.MethodPost, session, auth.csrfToken("sess-2"), http.StatusForbidden},
+		{"no session", http.MethodPost, nil, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/auth/logout", nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			if tt.token != "" {
+				req.Header.Set(csrfHeader, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,646 @@
+// api/bankimport.go
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type BankStatementLine struct {
+	ID       int `json:"id"`
+	ImportID int `json:"import_id"`
+	BankLine
+	Status          string  `json:"status"` // unmatched | matched | confirmed | ignored
+	CashflowEntryID *int    `json:"cashflow_entry_id,omitempty"`
+	ClientName      *string `json:"client_name,omitempty"`
+}
+
+type BankImportResponse struct {
+	ID         int                 `json:"id"`
+	Filename   *string             `json:"filename,omitempty"`
+	Format     string              `json:"format"`
+	ImportedAt string              `json:"imported_at"`
+	Lines      []BankStatementLine `json:"lines"`
+}
+
+type BankImportSummary struct {
+	ID         int     `json:"id"`
+	Filename   *string `json:"filename,omitempty"`
+	Format     string  `json:"format"`
+	ImportedAt string  `json:"imported_at"`
+	Lines      int     `json:"lines"`
+	Unmatched  int     `json:"unmatched"`
+	Matched    int     `json:"matched"`
+	Confirmed  int     `json:"confirmed"`
+}
+
+// Payload of the payment.received webhook event
+type PaymentReceivedEvent struct {
+	CashflowEntryID int     `json:"cashflow_entry_id"`
+	ContractID      int     `json:"contract_id"`
+	Amount          float64 `json:"amount"`
+	PaidDate        string  `json:"paid_date"`
+}
+
+// An open cashflow entry a statement line can be assigned to.
+type MatchCandidate struct {
+	CashflowEntryID int     `json:"cashflow_entry_id"`
+	ContractID      int     `json:"contract_id"`
+	ClientName      string  `json:"client_name"`
+	DueDate         string  `json:"due_date"`
+	Amount          float64 `json:"amount"`
+	Status          string  `json:"status"`
+	Score           int     `json:"score"`
+}
+
+/*
+	POST /api/bank-imports
+
+Upload a statement as multipart/form-data (field "file") or as raw body.
+Format is detected from the content unless ?format=camt053|mt940|csv is given.
+Credits are auto-matched against open cashflow_entries; debits are stored as ignored.
+*/
+func (h *Handler) ImportBankStatement(w http.ResponseWriter, r *http.Request) {
+	var data []byte
+	var filename *string
+	var err error
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, hdr, ferr := r.FormFile("file")
+		if ferr != nil {
+			http.Error(w, "file required: "+ferr.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		data, err = io.ReadAll(io.LimitReader(f, 10<<20))
+		filename = &hdr.Filename
+	} else {
+		data, err = io.ReadAll(io.LimitReader(r.Body, 10<<20))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "empty statement", http.StatusBadRequest)
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = detectStatementFormat(data)
+	}
+	lines, err := parseStatement(format, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	candidates, err := h.openMatchCandidates()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "begin tx: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var importID int
+	if err := tx.QueryRow(
+		`INSERT INTO bank_statement_imports (filename, format) VALUES ($1, $2) RETURNING id`,
+		filename, format,
+	).Scan(&importID); err != nil {
+		http.Error(w, "insert import: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	used := map[int]bool{}
+	for _, l := range lines {
+		status := "unmatched"
+		var entryID *int
+		if l.Amount <= 0 {
+			status = "ignored"
+		} else if best := bestMatch(l, candidates, used); best != nil {
+			status = "matched"
+			entryID = &best.CashflowEntryID
+			used[best.CashflowEntryID] = true
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO bank_statement_lines
+				(import_id, booking_date, amount, currency, counterparty_name, counterparty_iban, reference, status, cashflow_entry_id)
+			VALUES ($1, $2::date, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, $9)`,
+			importID, l.BookingDate, l.Amount, l.Currency, l.CounterpartyName, l.CounterpartyIBAN, l.Reference, status, entryID,
+		); err != nil {
+			http.Error(w, "insert line: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := h.loadBankImport(importID, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// GET /api/bank-imports
+func (h *Handler) ListBankImports(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(`
+		SELECT
+			i.id,
+			i.filename,
+			i.format,
+			to_char(i.imported_at, 'YYYY-MM-DD"T"HH24:MI:SSZ'),
+			COUNT(l.id),
+			COUNT(l.id) FILTER (WHERE l.status = 'unmatched'),
+			COUNT(l.id) FILTER (WHERE l.status = 'matched'),
+			COUNT(l.id) FILTER (WHERE l.status = 'confirmed')
+		FROM bank_statement_imports i
+		LEFT JOIN bank_statement_lines l ON l.import_id = i.id
+		GROUP BY i.id
+		ORDER BY i.imported_at DESC, i.id DESC`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []BankImportSummary{}
+	for rows.Next() {
+		var s BankImportSummary
+		if err := rows.Scan(&s.ID, &s.Filename, &s.Format, &s.ImportedAt, &s.Lines, &s.Unmatched, &s.Matched, &s.Confirmed); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// GET /api/bank-imports/{id}?status=unmatched
+func (h *Handler) GetBankImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid import id", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.loadBankImport(id, r.URL.Query().Get("status"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "import not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// GET /api/bank-imports/{id}/lines/{line_id}/candidates
+// Open entries ranked for manual assignment of a line.
+func (h *Handler) ListBankLineCandidates(w http.ResponseWriter, r *http.Request) {
+	importID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid import id", http.StatusBadRequest)
+		return
+	}
+	lineID, err := strconv.Atoi(chi.URLParam(r, "line_id"))
+	if err != nil {
+		http.Error(w, "invalid line id", http.StatusBadRequest)
+		return
+	}
+
+	var l BankLine
+	var name, ref sql.NullString
+	err = h.DB.QueryRow(`
+		SELECT amount, counterparty_name, reference
+		FROM bank_statement_lines
+		WHERE id = $1 AND import_id = $2`, lineID, importID).Scan(&l.Amount, &name, &ref)
+	if err == sql.ErrNoRows {
+		http.Error(w, "line not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	l.CounterpartyName, l.Reference = name.String, ref.String
+
+	candidates, err := h.openMatchCandidates()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range candidates {
+		candidates[i].Score = matchScore(l, candidates[i])
+	}
+	// best score first; among equals, the amount closest to the line
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return math.Abs(candidates[i].Amount-l.Amount) < math.Abs(candidates[j].Amount-l.Amount)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(candidates)
+}
+
+/*
+	PATCH /api/bank-imports/{id}/lines/{line_id}
+
+Manual assignment:
+
+	{ "cashflow_entry_id": 12 }
+
+Unassign or ignore:
+
+	{ "cashflow_entry_id": null }
+	{ "ignored": true }
+*/
+func (h *Handler) UpdateBankLine(w http.ResponseWriter, r *http.Request) {
+	importID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid import id", http.StatusBadRequest)
+		return
+	}
+	lineID, err := strconv.Atoi(chi.URLParam(r, "line_id"))
+	if err != nil {
+		http.Error(w, "invalid line id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		CashflowEntryID *int `json:"cashflow_entry_id"`
+		Ignored         bool `json:"ignored"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	var amount float64
+	if err := h.DB.QueryRow(
+		`SELECT status, amount FROM bank_statement_lines WHERE id = $1 AND import_id = $2`, lineID, importID,
+	).Scan(&status, &amount); err == sql.ErrNoRows {
+		http.Error(w, "line not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if status == "confirmed" {
+		http.Error(w, "line already confirmed", http.StatusConflict)
+		return
+	}
+
+	newStatus := "unmatched"
+	switch {
+	case req.Ignored:
+		newStatus, req.CashflowEntryID = "ignored", nil
+	case req.CashflowEntryID != nil:
+		if amount <= 0 {
+			http.Error(w, "debit lines cannot be assigned to a cashflow entry", http.StatusUnprocessableEntity)
+			return
+		}
+		var open bool
+		if err := h.DB.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM cashflow_entries
+				WHERE id = $1 AND status IN ('pending','submitted','overdue')
+			)`, *req.CashflowEntryID).Scan(&open); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !open {
+			http.Error(w, "cashflow entry not found or already paid", http.StatusBadRequest)
+			return
+		}
+		newStatus = "matched"
+	}
+
+	// the NOT EXISTS keeps two lines from claiming the same entry
+	res, err := h.DB.Exec(`
+		UPDATE bank_statement_lines
+		SET status = $1, cashflow_entry_id = $2
+		WHERE id = $3 AND import_id = $4
+		  AND ($2::int IS NULL OR NOT EXISTS (
+			SELECT 1 FROM bank_statement_lines o
+			WHERE o.cashflow_entry_id = $2 AND o.id <> $3 AND o.status IN ('matched','confirmed')
+		  ))`,
+		newStatus, req.CashflowEntryID, lineID, importID,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "cashflow entry already matched by another line", http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+	POST /api/bank-imports/{id}/confirm
+
+Books all matched lines (or only the given ones): the linked cashflow_entries
+become paid with the line's booking date.
+
+	{ "line_ids": [3, 4] }
+*/
+func (h *Handler) ConfirmBankMatches(w http.ResponseWriter, r *http.Request) {
+	importID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid import id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		LineIDs []int `json:"line_ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	lineIDs := make([]string, 0, len(req.LineIDs))
+	for _, id := range req.LineIDs {
+		lineIDs = append(lineIDs, strconv.Itoa(id))
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "begin tx: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// $2 is a comma-separated id list, empty = all matched lines of the import
+	rows, err := tx.Query(`
+		WITH sel AS (
+			SELECT DISTINCT ON (cashflow_entry_id) id, cashflow_entry_id, booking_date
+			FROM bank_statement_lines
+			WHERE import_id = $1
+			  AND status = 'matched'
+			  AND cashflow_entry_id IS NOT NULL
+			  AND ($2 = '' OR id = ANY (string_to_array($2, ',')::int[]))
+			ORDER BY cashflow_entry_id, id
+		),
+		paid AS (
+			UPDATE cashflow_entries cf
+			SET status = 'paid', paid_date = sel.booking_date
+			FROM sel
+			WHERE cf.id = sel.cashflow_entry_id
+			  AND cf.status IN ('pending','submitted','overdue')
+			RETURNING cf.id, cf.contract_id, cf.amount, to_char(cf.paid_date, 'YYYY-MM-DD') AS paid_date
+		),
+		-- lines whose entry was paid in the meantime stay matched
+		confirmed AS (
+			UPDATE bank_statement_lines l
+			SET status = 'confirmed'
+			FROM sel
+			JOIN paid ON paid.id = sel.cashflow_entry_id
+			WHERE l.id = sel.id
+			RETURNING l.id
+		)
+		SELECT id, contract_id, amount, paid_date FROM paid`,
+		importID, strings.Join(lineIDs, ","),
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var payments []PaymentReceivedEvent
+	for rows.Next() {
+		var p PaymentReceivedEvent
+		if err := rows.Scan(&p.CashflowEntryID, &p.ContractID, &p.Amount, &p.PaidDate); err != nil {
+			rows.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payments = append(payments, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, p := range payments {
+		h.emitEvent(EventPaymentReceived, p)
+	}
+
+	resp, err := h.loadBankImport(importID, "")
+	if err == sql.ErrNoRows {
+		http.Error(w, "import not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+/* ------------ Internal helpers ------------ */
+
+func (h *Handler) loadBankImport(id int, status string) (*BankImportResponse, error) {
+	resp := BankImportResponse{ID: id, Lines: []BankStatementLine{}}
+	if err := h.DB.QueryRow(`
+		SELECT filename, format, to_char(imported_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')
+		FROM bank_statement_imports WHERE id = $1`, id,
+	).Scan(&resp.Filename, &resp.Format, &resp.ImportedAt); err != nil {
+		return nil, err
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT
+			l.id,
+			to_char(l.booking_date, 'YYYY-MM-DD'),
+			l.amount,
+			COALESCE(l.currency, ''),
+			COALESCE(l.counterparty_name, ''),
+			COALESCE(l.counterparty_iban, ''),
+			COALESCE(l.reference, ''),
+			l.status,
+			l.cashflow_entry_id,
+			cl.name
+		FROM bank_statement_lines l
+		LEFT JOIN cashflow_entries cf ON cf.id = l.cashflow_entry_id
+		LEFT JOIN contracts c         ON c.id = cf.contract_id
+		LEFT JOIN clients cl          ON cl.id = c.client_id
+		WHERE l.import_id = $1
+		  AND ($2 = '' OR l.status = $2)
+		ORDER BY l.booking_date, l.id`, id, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		l := BankStatementLine{ImportID: id}
+		if err := rows.Scan(
+			&l.ID, &l.BookingDate, &l.Amount, &l.Currency, &l.CounterpartyName,
+			&l.CounterpartyIBAN, &l.Reference, &l.Status, &l.CashflowEntryID, &l.ClientName,
+		); err != nil {
+			return nil, err
+		}
+		resp.Lines = append(resp.Lines, l)
+	}
+	return &resp, rows.Err()
+}
+
+// openMatchCandidates returns unpaid entries (incl. submitted direct debits) not yet
+// claimed by another (unconfirmed) statement line.
+func (h *Handler) openMatchCandidates() ([]MatchCandidate, error) {
+	rows, err := h.DB.Query(`
+		SELECT cf.id, cf.contract_id, cl.name, to_char(cf.due_date, 'YYYY-MM-DD'), cf.amount, cf.status
+		FROM cashflow_entries cf
+		JOIN contracts c ON c.id = cf.contract_id
+		JOIN clients cl  ON cl.id = c.client_id
+		WHERE cf.status IN ('pending','submitted','overdue')
+		  AND NOT EXISTS (
+			SELECT 1 FROM bank_statement_lines l
+			WHERE l.cashflow_entry_id = cf.id AND l.status = 'matched'
+		  )
+		ORDER BY cf.due_date, cf.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []MatchCandidate{}
+	for rows.Next() {
+		var c MatchCandidate
+		if err := rows.Scan(&c.CashflowEntryID, &c.ContractID, &c.ClientName, &c.DueDate, &c.Amount, &c.Status); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// matchScore: 0 if the amount differs, otherwise 1 for the amount,
+// +2 if the payer is the client, +2 if the reference names the contract or
+// entry explicitly, +1 if the reference names the client.
+func matchScore(l BankLine, c MatchCandidate) int {
+	if math.Abs(l.Amount-c.Amount) >= 0.01 {
+		return 0
+	}
+	score := 1
+	if nameMatches(l.CounterpartyName, c.ClientName) {
+		score += 2
+	}
+	if referencesCandidate(l.Reference, c) {
+		score += 2
+	}
+	if nameMatches(l.Reference, c.ClientName) {
+		score++
+	}
+	return score
+}
+
+// "V-12", "Vertrag 12" (our SEPA remittance text) name contract 12;
+// "CF34" (our SEPA end-to-end id) names cashflow entry 34. A bare number
+// doesn't count: "Rate 3 von 12" is not contract 3.
+var (
+	contractRefPattern = regexp.MustCompile(`(?i)\b(?:v-|vertrag\s*)(\d+)\b`)
+	entryRefPattern    = regexp.MustCompile(`(?i)\bcf(\d+)\b`)
+)
+
+func referencesCandidate(ref string, c MatchCandidate) bool {
+	for _, m := range contractRefPattern.FindAllStringSubmatch(ref, -1) {
+		if m[1] == strconv.Itoa(c.ContractID) {
+			return true
+		}
+	}
+	for _, m := range entryRefPattern.FindAllStringSubmatch(ref, -1) {
+		if m[1] == strconv.Itoa(c.CashflowEntryID) {
+			return true
+		}
+	}
+	return false
+}
+
+// bestMatch picks the candidate for auto-matching. Besides the amount it
+// needs the payer name or an explicit reference; anything weaker stays a
+// suggestion in ListBankLineCandidates. Ties between different entries are
+// left for manual assignment; among entries of the same contract the
+// earliest due one wins.
+func bestMatch(l BankLine, candidates []MatchCandidate, used map[int]bool) *MatchCandidate {
+	var best *MatchCandidate
+	bestScore, tie := 0, false
+	for i := range candidates {
+		c := &candidates[i]
+		if used[c.CashflowEntryID] {
+			continue
+		}
+		if !nameMatches(l.CounterpartyName, c.ClientName) && !referencesCandidate(l.Reference, *c) {
+			continue
+		}
+		s := matchScore(l, *c)
+		switch {
+		case s > bestScore:
+			best, bestScore, tie = c, s, false
+		case s == bestScore && s > 0 && best != nil && best.ContractID != c.ContractID:
+			tie = true
+		}
+	}
+	if best == nil || tie {
+		return nil
+	}
+	return best
+}
+
+// nameMatches reports whether all name parts (≥3 chars) occur in text,
+// in any order and case, e.g. "Max Müller" matches "MUELLER, MAX".
+func nameMatches(text, name string) bool {
+	text = strings.ToLower(sepaUmlauts.Replace(text))
+	parts := strings.Fields(strings.ToLower(sepaUmlauts.Replace(name)))
+	n := 0
+	for _, p := range parts {
+		if len([]rune(p)) < 3 {
+			continue
+		}
+		if !strings.Contains(text, p) {
+			return false
+		}
+		n++
+	}
+	return n > 0
+}
@@ -0,0 +1,510 @@
+// api/bankparse.go
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// One credit/debit line from a bank statement, format-independent.
+type BankLine struct {
+	BookingDate      string  `json:"booking_date"` // YYYY-MM-DD
+	Amount           float64 `json:"amount"`       // negative = debit
+	Currency         string  `json:"currency,omitempty"`
+	CounterpartyName string  `json:"counterparty_name,omitempty"`
+	CounterpartyIBAN string  `json:"counterparty_iban,omitempty"`
+	Reference        string  `json:"reference,omitempty"`
+}
+
+// a :20: or :61: tag at the start of a line; a CSV time like 12:20:00 is not
+var mt940Tag = regexp.MustCompile(`(?m)^:(20|61):`)
+
+// detectStatementFormat guesses camt053 | mt940 | csv from the file content.
+func detectStatementFormat(data []byte) string {
+	head := data
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	switch {
+	case bytes.Contains(head, []byte("BkToCstmrStmt")), bytes.HasPrefix(bytes.TrimSpace(head), []byte("<?xml")):
+		return "camt053"
+	case mt940Tag.Match(head):
+		return "mt940"
+	default:
+		return "csv"
+	}
+}
+
+func parseStatement(format string, data []byte) ([]BankLine, error) {
+	switch format {
+	case "camt053":
+		return parseCAMT053(data)
+	case "mt940":
+		return parseMT940(data)
+	case "csv":
+		return parseStatementCSV(data)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+/* ------------ ISO 20022 CAMT.053 ------------ */
+
+// Only the parts we need. Element names are matched without namespace,
+// so camt.053.001.02 … .08 all decode.
+type camtDocument struct {
+	Stmts []struct {
+		Entries []struct {
+			Amt struct {
+				Value string `xml:",chardata"`
+				Ccy   string `xml:"Ccy,attr"`
+			} `xml:"Amt"`
+			CdtDbtInd string `xml:"CdtDbtInd"`
+			BookgDt   struct {
+				Dt   string `xml:"Dt"`
+				DtTm string `xml:"DtTm"`
+			} `xml:"BookgDt"`
+			AddtlNtryInf string `xml:"AddtlNtryInf"`
+			TxDtls       []struct {
+				// set per transaction in batched entries
+				Amt struct {
+					Value string `xml:",chardata"`
+					Ccy   string `xml:"Ccy,attr"`
+				} `xml:"AmtDtls>TxAmt>Amt"`
+				CdtDbtInd string `xml:"CdtDbtInd"`
+				RltdPties struct {
+					DbtrNm   string `xml:"Dbtr>Nm"`
+					DbtrPty  string `xml:"Dbtr>Pty>Nm"`
+					DbtrIBAN string `xml:"DbtrAcct>Id>IBAN"`
+					CdtrNm   string `xml:"Cdtr>Nm"`
+					CdtrPty  string `xml:"Cdtr>Pty>Nm"`
+					CdtrIBAN string `xml:"CdtrAcct>Id>IBAN"`
+				} `xml:"RltdPties"`
+				Ustrd []string `xml:"RmtInf>Ustrd"`
+				Ref   string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+				E2E   string   `xml:"Refs>EndToEndId"`
+			} `xml:"NtryDtls>TxDtls"`
+		} `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+func parseCAMT053(data []byte) ([]BankLine, error) {
+	var doc camtDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("camt053: %w", err)
+	}
+	var out []BankLine
+	for _, st := range doc.Stmts {
+		for _, n := range st.Entries {
+			amt, err := camtAmount(n.Amt.Value, n.CdtDbtInd)
+			if err != nil {
+				return nil, err
+			}
+			date := n.BookgDt.Dt
+			if date == "" && len(n.BookgDt.DtTm) >= 10 {
+				date = n.BookgDt.DtTm[:10]
+			}
+
+			entry := BankLine{BookingDate: date, Amount: amt, Currency: n.Amt.Ccy, Reference: n.AddtlNtryInf}
+			if len(n.TxDtls) == 0 {
+				out = append(out, entry)
+				continue
+			}
+			// A batched entry (collective credit, returned direct debits)
+			// becomes one line per transaction when each carries its amount;
+			// otherwise the entry stays one line with the first details.
+			split := len(n.TxDtls) > 1
+			for _, tx := range n.TxDtls {
+				if strings.TrimSpace(tx.Amt.Value) == "" {
+					split = false
+				}
+			}
+			for i, tx := range n.TxDtls {
+				if i > 0 && !split {
+					break
+				}
+				line := entry
+				if split {
+					ind := firstNonEmpty(strings.TrimSpace(tx.CdtDbtInd), n.CdtDbtInd)
+					if line.Amount, err = camtAmount(tx.Amt.Value, ind); err != nil {
+						return nil, err
+					}
+					line.Currency = firstNonEmpty(tx.Amt.Ccy, n.Amt.Ccy)
+				}
+				p := tx.RltdPties
+				// the counterparty is the debtor on credits and the creditor on debits
+				if line.Amount > 0 {
+					line.CounterpartyName = firstNonEmpty(p.DbtrNm, p.DbtrPty)
+					line.CounterpartyIBAN = p.DbtrIBAN
+				} else {
+					line.CounterpartyName = firstNonEmpty(p.CdtrNm, p.CdtrPty)
+					line.CounterpartyIBAN = p.CdtrIBAN
+				}
+				ref := strings.Join(tx.Ustrd, " ")
+				if tx.Ref != "" {
+					ref = strings.TrimSpace(ref + " " + tx.Ref)
+				}
+				if ref == "" && tx.E2E != "NOTPROVIDED" {
+					ref = tx.E2E
+				}
+				if ref != "" {
+					line.Reference = ref
+				}
+				out = append(out, line)
+			}
+		}
+	}
+	return out, nil
+}
+
+// camtAmount signs an <Amt> value by its CdtDbtInd: debits are negative.
+func camtAmount(value, cdtDbtInd string) (float64, error) {
+	amt, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("camt053: invalid amount %q", value)
+	}
+	if strings.TrimSpace(cdtDbtInd) != "CRDT" {
+		amt = -amt
+	}
+	return amt, nil
+}
+
+/* ------------ SWIFT MT940 ------------ */
+
+func parseMT940(data []byte) ([]BankLine, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	// Collect tag blocks (":61:…", ":86:…"), joining continuation lines.
+	type block struct{ tag, value string }
+	var blocks []block
+	for _, ln := range strings.Split(text, "\n") {
+		if len(ln) > 3 && ln[0] == ':' && strings.Index(ln[1:], ":") > 0 {
+			end := strings.Index(ln[1:], ":") + 1
+			blocks = append(blocks, block{tag: ln[1:end], value: ln[end+1:]})
+			continue
+		}
+		if ln == "-" || ln == "" || len(blocks) == 0 {
+			continue
+		}
+		blocks[len(blocks)-1].value += "\n" + ln
+	}
+
+	var currency string
+	var out []BankLine
+	for _, b := range blocks {
+		switch b.tag {
+		case "60F", "60M":
+			// C251001EUR1234,56 → currency sits at 7..10
+			if len(b.value) >= 10 {
+				currency = b.value[7:10]
+			}
+		case "61":
+			line, err := parseMT940StatementLine(b.value)
+			if err != nil {
+				return nil, err
+			}
+			line.Currency = currency
+			out = append(out, line)
+		case "86":
+			if len(out) == 0 {
+				continue
+			}
+			name, iban, ref := parseMT940Info(b.value)
+			last := &out[len(out)-1]
+			last.CounterpartyName, last.CounterpartyIBAN, last.Reference = name, iban, ref
+		}
+	}
+	return out, nil
+}
+
+// :61:YYMMDD[MMDD](C|D|RC|RD)[funds code]amount N…
+// The first date is the value date, the optional MMDD the booking (entry)
+// date; BookingDate is the latter when present.
+func parseMT940StatementLine(v string) (BankLine, error) {
+	v = strings.SplitN(v, "\n", 2)[0]
+	if len(v) < 8 {
+		return BankLine{}, fmt.Errorf("mt940: short :61: line %q", v)
+	}
+	d, err := time.Parse("060102", v[:6])
+	if err != nil {
+		return BankLine{}, fmt.Errorf("mt940: invalid value date %q", v[:6])
+	}
+	rest := v[6:]
+	if len(rest) >= 4 && isDigits(rest[:4]) {
+		entry, err := time.Parse("0102", rest[:4])
+		if err != nil {
+			return BankLine{}, fmt.Errorf("mt940: invalid entry date %q", rest[:4])
+		}
+		// the entry date has no year; take the one closest to the value date
+		// (booked 12-31, value 01-02 of the next year)
+		booked := time.Date(d.Year(), entry.Month(), entry.Day(), 0, 0, 0, 0, time.UTC)
+		switch {
+		case booked.Sub(d) > 180*24*time.Hour:
+			booked = booked.AddDate(-1, 0, 0)
+		case d.Sub(booked) > 180*24*time.Hour:
+			booked = booked.AddDate(1, 0, 0)
+		}
+		d, rest = booked, rest[4:]
+	}
+
+	sign := 1.0
+	switch {
+	case strings.HasPrefix(rest, "RC"):
+		sign, rest = -1, rest[2:]
+	case strings.HasPrefix(rest, "RD"):
+		sign, rest = 1, rest[2:]
+	case strings.HasPrefix(rest, "C"):
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "D"):
+		sign, rest = -1, rest[1:]
+	default:
+		return BankLine{}, fmt.Errorf("mt940: missing debit/credit mark in %q", v)
+	}
+	if len(rest) > 0 && rest[0] >= 'A' && rest[0] <= 'Z' {
+		rest = rest[1:] // funds code (third currency letter)
+	}
+	i := 0
+	for i < len(rest) && (rest[i] >= '0' && rest[i] <= '9' || rest[i] == ',') {
+		i++
+	}
+	amt, err := strconv.ParseFloat(strings.Replace(rest[:i], ",", ".", 1), 64)
+	if err != nil {
+		return BankLine{}, fmt.Errorf("mt940: invalid amount in %q", v)
+	}
+	return BankLine{BookingDate: d.Format("2006-01-02"), Amount: sign * amt}, nil
+}
+
+// parseMT940Info splits the :86: field. German banks use ?NN subfields
+// (?20-?29 purpose, ?31 IBAN, ?32/?33 name); anything else is kept as reference.
+func parseMT940Info(v string) (name, iban, ref string) {
+	v = strings.ReplaceAll(v, "\n", "")
+	if !strings.Contains(v, "?") {
+		return "", "", strings.TrimSpace(v)
+	}
+	var purpose []string
+	for _, part := range strings.Split(v, "?")[1:] {
+		if len(part) < 2 {
+			continue
+		}
+		code, val := part[:2], part[2:]
+		switch {
+		case code >= "20" && code <= "29", code >= "60" && code <= "63":
+			purpose = append(purpose, val)
+		case code == "31":
+			iban = val
+		case code == "32", code == "33":
+			name += val
+		}
+	}
+	return strings.TrimSpace(name), strings.TrimSpace(iban), strings.TrimSpace(strings.Join(purpose, ""))
+}
+
+/* ------------ Generic CSV ------------ */
+
+// Header aliases (lower-cased) for the common German/English bank exports.
+var csvColumns = map[string][]string{
+	"date":      {"booking_date", "bookingdate", "date", "buchungstag", "buchungsdatum", "datum", "valuta"},
+	"amount":    {"amount", "betrag", "betrag (eur)", "umsatz"},
+	"currency":  {"currency", "waehrung", "währung"},
+	"name":      {"name", "counterparty", "counterparty_name", "payer", "auftraggeber", "beguenstigter/zahlungspflichtiger", "begünstigter/zahlungspflichtiger", "zahlungspflichtiger", "name zahlungsbeteiligter"},
+	"iban":      {"iban", "counterparty_iban", "kontonummer/iban", "iban zahlungsbeteiligter"},
+	"reference": {"reference", "purpose", "description", "verwendungszweck", "buchungstext"},
+}
+
+func parseStatementCSV(data []byte) ([]BankLine, error) {
+	records, idx, err := readAliasedCSV(data, csvColumns)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := idx["date"]; !ok {
+		return nil, errors.New("csv: no date column")
+	}
+	if _, ok := idx["amount"]; !ok {
+		return nil, errors.New("csv: no amount column")
+	}
+
+	get := func(rec []string, col string) string {
+		i, ok := idx[col]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	amounts := make([]string, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		amounts = append(amounts, get(rec, "amount"))
+	}
+	dec := csvDecimalSep(amounts, csvComma(data))
+
+	var out []BankLine
+	for n, rec := range records[1:] {
+		if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+		date, err := parseLooseDate(get(rec, "date"))
+		if err != nil {
+			return nil, fmt.Errorf("csv row %d: %w", n+2, err)
+		}
+		amt, err := parseAmount(get(rec, "amount"), dec)
+		if err != nil {
+			return nil, fmt.Errorf("csv row %d: %w", n+2, err)
+		}
+		out = append(out, BankLine{
+			BookingDate:      date,
+			Amount:           amt,
+			Currency:         get(rec, "currency"),
+			CounterpartyName: get(rec, "name"),
+			CounterpartyIBAN: get(rec, "iban"),
+			Reference:        get(rec, "reference"),
+		})
+	}
+	return out, nil
+}
+
+// csvComma is ';' when most of the first lines have more semicolons than
+// commas. Lines vote rather than just the first one: exports may put a
+// report title ("Umsätze, Januar 2025") above the header.
+func csvComma(data []byte) rune {
+	semi, comma := 0, 0
+	for n, line := range bytes.SplitN(data, []byte("\n"), 21) {
+		if n == 20 {
+			break
+		}
+		s, c := bytes.Count(line, []byte(";")), bytes.Count(line, []byte(","))
+		switch {
+		case s > c:
+			semi++
+		case c > s:
+			comma++
+		}
+	}
+	if semi > comma {
+		return ';'
+	}
+	return ','
+}
+
+// readAliasedCSV reads a ';' or ',' separated file and maps the header
+// (case-insensitive) onto the column names of aliases.
+func readAliasedCSV(data []byte, aliases map[string][]string) ([][]string, map[string]int, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // BOM
+	rd := csv.NewReader(bytes.NewReader(data))
+	rd.Comma = csvComma(data)
+	rd.FieldsPerRecord = -1
+	rd.LazyQuotes = true
+
+	records, err := rd.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("csv: %w", err)
+	}
+	if len(records) < 2 {
+		return nil, nil, errors.New("csv: no data rows")
+	}
+
+	// the header is the first row naming at least two known columns;
+	// platform exports put a report title and date range above it
+	for n, rec := range records {
+		idx := map[string]int{}
+		for i, h := range rec {
+			h = strings.ToLower(strings.TrimSpace(h))
+			for col, names := range aliases {
+				if _, ok := idx[col]; ok {
+					continue
+				}
+				for _, a := range names {
+					if h == a {
+						idx[col] = i
+					}
+				}
+			}
+		}
+		if len(idx) >= 2 {
+			return records[n:], idx, nil
+		}
+	}
+	return records, map[string]int{}, nil
+}
+
+func parseLooseDate(s string) (string, error) {
+	for _, layout := range []string{"2006-01-02", "02.01.2006", "02.01.06", "02/01/2006", "2.1.2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("invalid date %q", s)
+}
+
+// cleanAmount strips currency and spaces: "800,00 EUR", "€800.00".
+func cleanAmount(s string) string {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "EUR"))
+	return strings.NewReplacer(" ", "", "€", "", "\u00a0", "").Replace(s)
+}
+
+// csvDecimalSep decides once per file whether ',' or '.' is the decimal
+// separator, so "1,234" is read the same way in every row. A value with
+// both separators settles it (the last one is decimal), as does a
+// separator not followed by exactly three digits. If nothing settles it,
+// ';'-separated files are taken as German exports (decimal comma).
+func csvDecimalSep(values []string, comma rune) rune {
+	for _, v := range values {
+		v = cleanAmount(v)
+		c, d := strings.LastIndex(v, ","), strings.LastIndex(v, ".")
+		switch {
+		case c >= 0 && d >= 0:
+			if c > d {
+				return ','
+			}
+			return '.'
+		case c >= 0 && len(v)-c-1 != 3:
+			return ','
+		case d >= 0 && len(v)-d-1 != 3:
+			return '.'
+		}
+	}
+	if comma == ';' {
+		return ','
+	}
+	return '.'
+}
+
+// parseAmount accepts "1234.56", "1.234,56", "1,234.56", "-800,00" and
+// "800,00 EUR" / "€800.00"; dec is the decimal separator of the file.
+func parseAmount(s string, dec rune) (float64, error) {
+	s = cleanAmount(s)
+	if dec == ',' {
+		s = strings.ReplaceAll(s, ".", "") // 1.234,56
+		s = strings.Replace(s, ",", ".", 1)
+	} else {
+		s = strings.ReplaceAll(s, ",", "") // 1,234.56
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return v, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCSVComma(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want rune
+	}{
+		{"semicolon", "Datum;Betrag;Name\n02.01.2025;-800,00;Max\n", ';'},
+		{"comma", "date,amount,name\n2025-01-02,800.00,Max\n", ','},
+		{"title with comma above a semicolon header",
+			"Umsätze Girokonto, Januar 2025\nZeitraum: 01.01.2025 - 31.01.2025\n" +
+				"Buchungstag;Betrag;Auftraggeber;Verwendungszweck\n02.01.2025;450,00;Max Müller;V-7\n03.01.2025;-19,99;Erika;Gebühr\n", ';'},
+		{"decimal commas in a semicolon file", "Datum;Betrag\n02.01.2025;1,00\n03.01.2025;2,00\n", ';'},
+	}
+	for _, tt := range tests {
+		if got := csvComma([]byte(tt.data)); got != tt.want {
+			t.Errorf("%s: csvComma = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCSVDecimalSep(t *testing.T) {
+	tests := []struct {
+		values []string
+		comma  rune
+		want   rune
+	}{
+		{[]string{"1,234", "2,500"}, ',', '.'},  // thousands in an English export
+		{[]string{"1,234", "2,500"}, ';', ','},  // unsettled German export
+		{[]string{"1,234", "12,5"}, ',', ','},   // "12,5" settles it
+		{[]string{"1.234", "800.00"}, ';', '.'}, // "800.00" settles it
+		{[]string{"1.234,56"}, ',', ','},        // both separators
+		{[]string{"1,234.56"}, ';', '.'},        // both separators
+		{[]string{"800,00 EUR", "€ 1.000,00"}, ',', ','},
+		{[]string{"", "100"}, ',', '.'},
+	}
+	for _, tt := range tests {
+		if got := csvDecimalSep(tt.values, tt.comma); got != tt.want {
+			t.Errorf("csvDecimalSep(%q, %q) = %q, want %q", tt.values, tt.comma, got, tt.want)
+		}
+	}
+}
+
+func TestParseStatementCSV(t *testing.T) {
+	german := "Umsätze Girokonto, Januar 2025\n\n" +
+		"Buchungstag;Betrag;Auftraggeber;Verwendungszweck\n" +
+		"02.01.2025;1.234;Max Müller;V-7 Januar\n" +
+		"03.01.2025;-800,00;Erika Mustermann;Miete, Januar\n"
+	got, err := parseStatementCSV([]byte(german))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BankLine{
+		{BookingDate: "2025-01-02", Amount: 1234, CounterpartyName: "Max Müller", Reference: "V-7 Januar"},
+		{BookingDate: "2025-01-03", Amount: -800, CounterpartyName: "Erika Mustermann", Reference: "Miete, Januar"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("german export:\n got %+v\nwant %+v", got, want)
+	}
+
+	english := "date,amount,name\n2025-01-02,\"1,234\",Max\n2025-01-03,\"2,000.50\",Erika\n"
+	got, err = parseStatementCSV([]byte(english))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Amount != 1234 || got[1].Amount != 2000.5 {
+		t.Errorf("english export: %+v", got)
+	}
+}
+
+func TestParseMT940StatementLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		date   string
+		amount float64
+	}{
+		{"250115C450,00NTRFNONREF", "2025-01-15", 450},
+		{"2501150114D19,99NDDTNONREF", "2025-01-14", -19.99},
+		// booked on 12-31, value date in the new year
+		{"2501021231C450,00NTRFNONREF", "2024-12-31", 450},
+		// booked in the new year, value date on 12-31
+		{"2412310102D10,NTRFNONREF", "2025-01-02", -10},
+		{"250115RC5,00NTRFNONREF", "2025-01-15", -5},
+		{"250115CR100,50NTRFNONREF", "2025-01-15", 100.5},
+	}
+	for _, tt := range tests {
+		got, err := parseMT940StatementLine(tt.line)
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		if got.BookingDate != tt.date || got.Amount != tt.amount {
+			t.Errorf("%s: got %s %v, want %s %v", tt.line, got.BookingDate, got.Amount, tt.date, tt.amount)
+		}
+	}
+}
+
+func TestDetectStatementFormat(t *testing.T) {
+	tests := map[string]string{
+		":20:STARTUMS\n:25:10020030/1234567\n:61:250115C450,00NTRFNONREF\n": "mt940",
+		"Zeit;Betrag\n12:20:00;4,00\n":                                      "csv",
+		`<?xml version="1.0"?><Document><BkToCstmrStmt/></Document>`:        "camt053",
+	}
+	for data, want := range tests {
+		if got := detectStatementFormat([]byte(data)); got != want {
+			t.Errorf("detectStatementFormat(%q) = %s, want %s", data, got, want)
+		}
+	}
+}
+
+const camtBatch = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+<BkToCstmrStmt><Stmt>
+  <Ntry>
+    <Amt Ccy="EUR">300.00</Amt><CdtDbtInd>CRDT</CdtDbtInd>
+    <BookgDt><Dt>2025-01-15</Dt></BookgDt>
+    <AddtlNtryInf>SAMMLER</AddtlNtryInf>
+    <NtryDtls>
+      <TxDtls>
+        <AmtDtls><TxAmt><Amt Ccy="EUR">100.00</Amt></TxAmt></AmtDtls>
+        <RltdPties><Dbtr><Nm>Max Müller</Nm></Dbtr><DbtrAcct><Id><IBAN>DE02120300000000202051</IBAN></Id></DbtrAcct></RltdPties>
+        <RmtInf><Ustrd>V-7</Ustrd></RmtInf>
+      </TxDtls>
+      <TxDtls>
+        <AmtDtls><TxAmt><Amt Ccy="EUR">200.00</Amt></TxAmt></AmtDtls>
+        <RltdPties><Dbtr><Nm>Erika Mustermann</Nm></Dbtr></RltdPties>
+        <RmtInf><Ustrd>V-8</Ustrd></RmtInf>
+      </TxDtls>
+    </NtryDtls>
+  </Ntry>
+  <Ntry>
+    <Amt Ccy="EUR">50.00</Amt><CdtDbtInd>DBIT</CdtDbtInd>
+    <BookgDt><DtTm>2025-01-16T10:00:00</DtTm></BookgDt>
+    <NtryDtls>
+      <TxDtls><RltdPties><Cdtr><Nm>Bank A</Nm></Cdtr></RltdPties></TxDtls>
+      <TxDtls><RltdPties><Cdtr><Nm>Bank B</Nm></Cdtr></RltdPties></TxDtls>
+    </NtryDtls>
+  </Ntry>
+</Stmt></BkToCstmrStmt>
+</Document>`
+
+func TestParseCAMT053Batch(t *testing.T) {
+	got, err := parseCAMT053([]byte(camtBatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BankLine{
+		// split: every transaction carries its amount
+		{BookingDate: "2025-01-15", Amount: 100, Currency: "EUR", CounterpartyName: "Max Müller",
+			CounterpartyIBAN: "DE02120300000000202051", Reference: "V-7"},
+		{BookingDate: "2025-01-15", Amount: 200, Currency: "EUR", CounterpartyName: "Erika Mustermann", Reference: "V-8"},
+		// not split: no per-transaction amounts, first details only
+		{BookingDate: "2025-01-16", Amount: -50, Currency: "EUR", CounterpartyName: "Bank A"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCAMT053:\n got %+v\nwant %+v", got, want)
+	}
+}
@@ -11,6 +11,12 @@ type CashflowRow struct {
 	Month     string  `json:"month"`     // YYYY-MM
 	Confirmed float64 `json:"confirmed"` // invoiced or scheduled from contracts
 	Potential float64 `json:"potential"` // open deals
+	Inflow    float64 `json:"inflow"`    // = confirmed
+	AdSpend   float64 `json:"ad_spend"`  // ad_spend_entries
+	Expenses  float64 `json:"expenses"`  // one-off + recurring expenses
+	Outflow   float64 `json:"outflow"`   // ad_spend + expenses
+	Net       float64 `json:"net"`       // inflow - outflow
+	Balance   float64 `json:"balance"`   // running, from app_settings opening_balance
 }
 
 func (h *Handler) CashflowForecast(w http.ResponseWriter, r *http.Request) {
@@ -21,6 +27,8 @@ func (h *Handler) CashflowForecast(w http.ResponseWriter, r *http.Request) {
 	// 🔧 read tunables from app_settings (defaults if not present)
 	potentialMonths := h.getNumericSetting("potential_months", 6)
 	potentialFlatEUR := h.getNumericSetting("potential_flat_eur", 900)
+	// bank balance at the start of the current month
+	balance := h.getNumericSetting("opening_balance", 0)
 
 	rows, err := h.DB.Query(`
 WITH months AS (
@@ -129,16 +137,34 @@ confirmed_collapsed AS (
   GROUP BY ym
 ),
 
+-- G) Outflow: ad spend booked in the ledger and expenses
+spend AS (
+  SELECT to_char(e.spend_date, 'YYYY-MM') AS ym, SUM(e.amount)::numeric AS amt
+  FROM ad_spend_entries e
+  WHERE e.spend_date >= $1::date AND e.spend_date < $2::date
+  GROUP BY 1
+),
+`+expenseOccurrencesCTE+`,
+expense_month AS (
+  SELECT to_char(due_date, 'YYYY-MM') AS ym, SUM(amount)::numeric AS amt
+  FROM expense_occ
+  GROUP BY 1
+),
+
 joined AS (
   SELECT
     m.ym,
     COALESCE(cc.amt, 0) AS confirmed,
-    COALESCE(pt.amt, 0) AS potential
+    COALESCE(pt.amt, 0) AS potential,
+    COALESCE(sp.amt, 0) AS ad_spend,
+    COALESCE(ex.amt, 0) AS expenses
   FROM months m
   LEFT JOIN confirmed_collapsed cc ON cc.ym = m.ym
   LEFT JOIN potential pt          ON pt.ym = m.ym
+  LEFT JOIN spend sp              ON sp.ym = m.ym
+  LEFT JOIN expense_month ex      ON ex.ym = m.ym
 )
-SELECT ym AS month, confirmed, potential
+SELECT ym AS month, confirmed, potential, ad_spend, expenses
 FROM joined
 ORDER BY month;
 `, start, end, potentialMonths, potentialFlatEUR)
@@ -151,10 +177,15 @@ ORDER BY month;
 	var out []CashflowRow
 	for rows.Next() {
 		var row CashflowRow
-		if err := rows.Scan(&row.Month, &row.Confirmed, &row.Potential); err != nil {
+		if err := rows.Scan(&row.Month, &row.Confirmed, &row.Potential, &row.AdSpend, &row.Expenses); err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
+		row.Inflow = row.Confirmed
+		row.Outflow = row.AdSpend + row.Expenses
+		row.Net = row.Inflow - row.Outflow
+		balance += row.Net
+		row.Balance = balance
 		out = append(out, row)
 	}
 
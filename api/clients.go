@@ -19,9 +19,10 @@ type Client struct {
 }
 
 type Handler struct {
-	DB   *sql.DB
-	Cfg  *Config
-	Auth *Auth
+	DB     *sql.DB
+	Cfg    *Config
+	Auth   *Auth
+	Mailer MailTransport // nil = mails are queued but not sent
 }
 
 // GET /api/clients
@@ -86,6 +87,8 @@ func (h *Handler) CreateClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.emitEvent(EventClientCreated, c)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(c)
@@ -1,8 +1,13 @@
 package api
 
 import (
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,16 +18,32 @@ type Config struct {
 	DatabaseURL        string
 	GoogleClientID     string
 	GoogleClientSecret string
-	AllowedEmails      []string // comma-separated
+	AllowedEmails      []string // comma-separated, legacy: seeded into users as invited
+	AdminEmails        []string // comma-separated, always get the admin role
 	CookieSigningKey   string
+	OldSigningKeys     []string      // comma-separated, still accepted after a key rotation
+	SessionIdleTimeout time.Duration // sessions end after this much inactivity
+	SessionMaxAge      time.Duration // absolute limit, even for active sessions
 	OAuthRedirectURL   string
 	PostLoginRedirect  string
 	CORSOrigins        []string // comma-separated
+	TrustProxy         bool     // client address from X-Forwarded-For (only behind a proxy that sets it)
+	SMTPHost           string   // empty = mail queue is filled but never sent
+	SMTPPort           string
+	SMTPUsername       string
+	SMTPPassword       string
+	SMTPFrom           string
+	AlertEmails        []string // comma-separated, internal notifications
+	LeadHookTokens     []string // comma-separated, accepted by POST /hooks/leads
+	OIDCProviders      []OIDCProviderConfig
+	DevLoginEmail      string // APP_ENV=local only: default user of /auth/dev
+	DevLoginRole       string
 }
 
 func LoadConfig() (*Config, error) {
 	env := strings.ToLower(strings.TrimSpace(os.Getenv("APP_ENV")))
-	if env == "" {
+	defaulted := env == ""
+	if defaulted {
 		env = "local"
 	}
 
@@ -31,6 +52,16 @@ func LoadConfig() (*Config, error) {
 		_ = godotenv.Load(".env")           // optional, shared defaults
 		_ = godotenv.Overload(".env.local") // laptop-only secrets
 	}
+	if defaulted {
+		// APP_ENV may come from the .env files; without it, local mode
+		// (dev login, no signing key, no debug guard) is only assumed for
+		// a database on this machine
+		if v := strings.ToLower(strings.TrimSpace(os.Getenv("APP_ENV"))); v != "" {
+			env = v
+		} else if host := databaseHost(os.Getenv("DATABASE_URL")); !isLoopbackHost(host) {
+			return nil, fmt.Errorf("APP_ENV is not set and DATABASE_URL points at %s; set APP_ENV=prod (or local)", host)
+		}
+	}
 
 	cfg := &Config{
 		AppEnv:             env,
@@ -39,14 +70,115 @@ func LoadConfig() (*Config, error) {
 		GoogleClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
 		GoogleClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
 		AllowedEmails:      splitCSV(os.Getenv("ALLOWED_EMAILS")),
+		AdminEmails:        splitCSV(os.Getenv("ADMIN_EMAILS")),
 		CookieSigningKey:   os.Getenv("COOKIE_SIGNING_KEY"),
 		OAuthRedirectURL:   os.Getenv("OAUTH_REDIRECT_URL"),
 		PostLoginRedirect:  os.Getenv("POST_LOGIN_REDIRECT"),
 		CORSOrigins:        splitCSV(os.Getenv("CORS_ORIGINS")),
+		SMTPHost:           os.Getenv("SMTP_HOST"),
+		SMTPPort:           fallback(os.Getenv("SMTP_PORT"), "587"),
+		SMTPUsername:       os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:       os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:           os.Getenv("SMTP_FROM"),
+		AlertEmails:        splitCSV(os.Getenv("ALERT_EMAILS")),
+		LeadHookTokens:     splitCSV(os.Getenv("LEAD_HOOK_TOKENS")),
+		OldSigningKeys:     splitCSV(os.Getenv("COOKIE_SIGNING_KEYS_OLD")),
+		DevLoginEmail:      fallback(os.Getenv("DEV_LOGIN_EMAIL"), "dev@localhost"),
+		DevLoginRole:       fallback(os.Getenv("DEV_LOGIN_ROLE"), "admin"),
+	}
+
+	var err error
+	if cfg.OIDCProviders, err = loadOIDCProviders(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.TrustProxy, err = parseBool("TRUST_PROXY"); err != nil {
+		return nil, err
+	}
+	if cfg.SessionIdleTimeout, err = parseDuration("SESSION_IDLE_TIMEOUT", 12*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.SessionMaxAge, err = parseDuration("SESSION_MAX_AGE", 30*24*time.Hour); err != nil {
+		return nil, err
 	}
 	return cfg, nil
 }
 
+// loadOIDCProviders reads OIDC_PROVIDERS=google,microsoft and for each name
+// OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL and the
+// optional _SCOPES, _EMAIL_CLAIM, _NAME_CLAIM, _EMAIL_VERIFIED. Without an
+// explicit "google" entry, GOOGLE_CLIENT_ID/SECRET and OAUTH_REDIRECT_URL
+// still configure Google.
+func loadOIDCProviders(cfg *Config) ([]OIDCProviderConfig, error) {
+	var out []OIDCProviderConfig
+	seen := map[string]bool{}
+	for _, name := range splitCSV(os.Getenv("OIDC_PROVIDERS")) {
+		name = strings.ToLower(name)
+		env := func(k string) string {
+			return os.Getenv("OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_" + k)
+		}
+		p := OIDCProviderConfig{
+			Name:          name,
+			Issuer:        env("ISSUER"),
+			ClientID:      env("CLIENT_ID"),
+			ClientSecret:  env("CLIENT_SECRET"),
+			RedirectURL:   env("REDIRECT_URL"),
+			Scopes:        splitCSV(env("SCOPES")),
+			EmailClaim:    env("EMAIL_CLAIM"),
+			NameClaim:     env("NAME_CLAIM"),
+			EmailVerified: strings.ToLower(env("EMAIL_VERIFIED")),
+			// Entra ID: xms_edov (add it as optional claim in the app registration)
+			EmailVerifiedClaim: env("EMAIL_VERIFIED_CLAIM"),
+			Tenants:            splitCSV(env("TENANTS")),
+		}
+		if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			return nil, fmt.Errorf("oidc provider %q: ISSUER, CLIENT_ID and REDIRECT_URL are required", name)
+		}
+		switch p.EmailVerified {
+		case "", "required", "if_present", "ignore":
+		default:
+			return nil, fmt.Errorf("oidc provider %q: EMAIL_VERIFIED must be required, if_present or ignore", name)
+		}
+		seen[name] = true
+		out = append(out, p)
+	}
+	if !seen["google"] && cfg.GoogleClientID != "" {
+		out = append(out, OIDCProviderConfig{
+			Name:         "google",
+			Issuer:       "https://accounts.google.com",
+			ClientID:     cfg.GoogleClientID,
+			ClientSecret: cfg.GoogleClientSecret,
+			RedirectURL:  cfg.OAuthRedirectURL,
+		})
+	}
+	return out, nil
+}
+
+// databaseHost returns the host of a postgres:// URL or key=value DSN; ""
+// means the default unix socket.
+func databaseHost(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if h := u.Hostname(); h != "" {
+			return h
+		}
+		return u.Query().Get("host")
+	}
+	for _, kv := range strings.Fields(dsn) {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == "host" {
+			return strings.Trim(v, "'")
+		}
+	}
+	return ""
+}
+
+// isLoopbackHost: localhost, a loopback address or a unix socket path.
+func isLoopbackHost(host string) bool {
+	if host == "" || strings.HasPrefix(host, "/") || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 func splitCSV(s string) []string {
 	if s == "" {
 		return nil
@@ -68,3 +200,27 @@ func fallback(v, def string) string {
 	}
 	return v
 }
+
+func parseBool(key string) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: invalid boolean %q", key, v)
+	}
+	return b, nil
+}
+
+func parseDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s: invalid duration %q", key, v)
+	}
+	return d, nil
+}
@@ -33,6 +33,9 @@ type ContractResponse struct {
 	PaidMonths      int     `json:"paid_months"`
 	PaidAmountTotal float64 `json:"paid_amount_total"`
 	NextDueDate     *string `json:"next_due_date,omitempty"`
+	DunningLevel    int     `json:"dunning_level"`  // highest level among open entries
+	DunningStatus   string  `json:"dunning_status"` // none | zahlungserinnerung | mahnung_1 | mahnung_2
+	DunningFees     float64 `json:"dunning_fees"`   // fees charged on open entries
 }
 
 // GET /api/contracts
@@ -53,8 +56,18 @@ pending AS (
     contract_id,
     MIN(due_date)::date AS next_due_date_cf
   FROM cashflow_entries
-  WHERE status IN ('pending','overdue')
+  WHERE status IN ('pending','submitted','overdue')
   GROUP BY contract_id
+),
+dunning AS (
+  SELECT
+    cf.contract_id,
+    MAX(cf.dunning_level)               AS dunning_level,
+    COALESCE(SUM(dn.fee), 0)::numeric   AS dunning_fees
+  FROM cashflow_entries cf
+  LEFT JOIN dunning_notices dn ON dn.cashflow_entry_id = cf.id
+  WHERE cf.status IN ('pending','submitted','overdue')
+  GROUP BY cf.contract_id
 )
 SELECT
   c.id,
@@ -113,11 +126,15 @@ SELECT
 			)::date
 
     END
-  ) AS next_due_date
+  ) AS next_due_date,
+
+  COALESCE(d.dunning_level, 0) AS dunning_level,
+  COALESCE(d.dunning_fees, 0)  AS dunning_fees
 FROM contracts c
 JOIN clients cl ON cl.id = c.client_id
 LEFT JOIN paid    p  ON p.contract_id  = c.id
 LEFT JOIN pending pn ON pn.contract_id = c.id
+LEFT JOIN dunning d  ON d.contract_id  = c.id
 ORDER BY c.id;
 `)
 	if err != nil {
@@ -133,10 +150,12 @@ ORDER BY c.id;
 			&x.ID, &x.ClientID, &x.ClientName, &x.SalesProcessID,
 			&x.StartDate, &x.EndDate, &x.DurationMonths, &x.RevenueTotal, &x.PaymentFreq,
 			&x.MonthlyAmount, &x.PaidMonths, &x.PaidAmountTotal, &x.NextDueDate,
+			&x.DunningLevel, &x.DunningFees,
 		); err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
+		x.DunningStatus = dunningLevelNames[x.DunningLevel]
 		out = append(out, x)
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -168,6 +187,8 @@ func (h *Handler) CreateContract(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.emitEvent(EventContractCreated, c)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(c)
 }
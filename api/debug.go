@@ -0,0 +1,280 @@
+// api/debug.go
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequireDebugAccess lets admin sessions through, and in local mode
+// direct requests from this machine or the local network (the same check
+// as /auth/dev).
+func (h *Handler) RequireDebugAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.isLocal() && devLoginAllowed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sess, ok := h.parseSession(r)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if sess.Role != RoleAdmin {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type debugCookie struct {
+	Name   string `json:"name"`
+	Length int    `json:"length"`
+}
+
+type debugSession struct {
+	Cookies     []debugCookie `json:"cookies"`
+	SignedWith  string        `json:"signed_with,omitempty"` // current | old key #n
+	Session     *Session      `json:"session,omitempty"`
+	SessionNote string        `json:"session_note,omitempty"`
+}
+
+type debugCheck struct {
+	Name string `json:"name"`
+	OK   bool   `json:"ok"`
+	Note string `json:"note,omitempty"`
+}
+
+type debugDB struct {
+	OK               bool    `json:"ok"`
+	Error            string  `json:"error,omitempty"`
+	LatencyMS        float64 `json:"latency_ms"`
+	MigrationVersion *int64  `json:"migration_version,omitempty"`
+	MigrationDirty   *bool   `json:"migration_dirty,omitempty"`
+	OpenConnections  int     `json:"open_connections"`
+}
+
+type debugBuild struct {
+	GoVersion string            `json:"go_version"`
+	Module    string            `json:"module,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	Settings  map[string]string `json:"settings,omitempty"` // vcs.revision, vcs.time, ...
+	Uptime    string            `json:"uptime"`
+}
+
+var startedAt = time.Now()
+
+// GET /debug - session, redacted config with sanity checks, DB and build
+// info. Cookie values, signatures and secrets are never echoed.
+func (h *Handler) DebugInfo(w http.ResponseWriter, r *http.Request) {
+	out := map[string]any{
+		"env":     h.Cfg.AppEnv,
+		"session": h.debugSession(r),
+		"config":  h.redactedConfig(),
+		"checks":  h.configChecks(),
+		"db":      h.debugDB(r.Context()),
+		"build":   debugBuildInfo(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func (h *Handler) debugSession(r *http.Request) debugSession {
+	ds := debugSession{Cookies: []debugCookie{}}
+	for _, c := range r.Cookies() {
+		ds.Cookies = append(ds.Cookies, debugCookie{Name: c.Name, Length: len(c.Value)})
+	}
+
+	c, err := r.Cookie(h.Auth.CookieName)
+	if err != nil {
+		ds.SessionNote = "no session cookie"
+		return ds
+	}
+	id, sig, _ := strings.Cut(c.Value, ".")
+	for i, key := range h.Auth.CookieKeys {
+		if hmac.Equal([]byte(hmacSign(key, []byte(id))), []byte(sig)) {
+			ds.SignedWith = "current key"
+			if i > 0 {
+				ds.SignedWith = "old key #" + strconv.Itoa(i)
+			}
+		}
+	}
+	if ds.SignedWith == "" {
+		ds.SessionNote = "signature does not match any accepted key"
+		return ds
+	}
+	sess, ok := h.parseSession(r)
+	if !ok {
+		ds.SessionNote = "session revoked, expired, idle or user disabled"
+		return ds
+	}
+	cp := *sess
+	if len(cp.ID) > 8 {
+		cp.ID = cp.ID[:8] + "…"
+	}
+	ds.Session = &cp
+	return ds
+}
+
+func redactSecret(v string) string {
+	if v == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// redactedConfig shows Config with secrets replaced by "[redacted]" (set)
+// or "" (unset).
+func (h *Handler) redactedConfig() map[string]any {
+	c := h.Cfg
+	oldKeys := make([]string, len(c.OldSigningKeys))
+	for i := range oldKeys {
+		oldKeys[i] = "[redacted]"
+	}
+	providers := []map[string]any{}
+	for _, p := range c.OIDCProviders {
+		providers = append(providers, map[string]any{
+			"name":           p.Name,
+			"issuer":         p.Issuer,
+			"client_id":      p.ClientID,
+			"client_secret":  redactSecret(p.ClientSecret),
+			"redirect_url":   p.RedirectURL,
+			"email_claim":    p.EmailClaim,
+			"name_claim":     p.NameClaim,
+			"email_verified": p.EmailVerified,
+		})
+	}
+	return map[string]any{
+		"app_env":              c.AppEnv,
+		"port":                 c.Port,
+		"database":             redactedDatabase(c.DatabaseURL),
+		"google_client_id":     c.GoogleClientID,
+		"google_client_secret": redactSecret(c.GoogleClientSecret),
+		"allowed_emails":       c.AllowedEmails,
+		"admin_emails":         c.AdminEmails,
+		"cookie_signing_key":   redactSecret(c.CookieSigningKey),
+		"old_signing_keys":     oldKeys,
+		"session_idle_timeout": c.SessionIdleTimeout.String(),
+		"session_max_age":      c.SessionMaxAge.String(),
+		"oauth_redirect_url":   c.OAuthRedirectURL,
+		"post_login_redirect":  c.PostLoginRedirect,
+		"cors_origins":         h.corsOrigins(),
+		"oidc_providers":       providers,
+		"smtp_host":            c.SMTPHost,
+		"smtp_port":            c.SMTPPort,
+		"smtp_username":        c.SMTPUsername,
+		"smtp_password":        redactSecret(c.SMTPPassword),
+		"smtp_from":            c.SMTPFrom,
+		"alert_emails":         c.AlertEmails,
+		"lead_hook_tokens":     len(c.LeadHookTokens),
+		"dev_login_email":      c.DevLoginEmail,
+		"dev_login_role":       c.DevLoginRole,
+	}
+}
+
+// redactedDatabase shows only host/dbname of a postgres URL. Other DSNs
+// (key=value) may carry the password anywhere, so they are not shown.
+func redactedDatabase(dsn string) string {
+	if dsn == "" {
+		return ""
+	}
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" {
+		return "[redacted]"
+	}
+	return databaseHost(dsn) + u.Path
+}
+
+// configChecks flags settings that are likely wrong for the environment.
+func (h *Handler) configChecks() []debugCheck {
+	c := h.Cfg
+	local := h.isLocal()
+	var out []debugCheck
+	add := func(name string, ok bool, note string) {
+		ck := debugCheck{Name: name, OK: ok}
+		if !ok {
+			ck.Note = note
+		}
+		out = append(out, ck)
+	}
+
+	add("cookie_signing_key", len(c.CookieSigningKey) >= 32 || (local && c.CookieSigningKey == ""),
+		"must be >= 32 bytes")
+	add("login_provider", len(c.OIDCProviders) > 0 || local,
+		"no OIDC provider configured, nobody can sign in")
+	add("admin_emails", len(c.AdminEmails) > 0,
+		"no ADMIN_EMAILS, admins can only be created by other admins")
+
+	pl, err := url.Parse(c.PostLoginRedirect)
+	add("post_login_redirect", c.PostLoginRedirect == "" || (err == nil && pl.Host != ""),
+		"must be an absolute URL")
+	if !local {
+		add("post_login_redirect_https", strings.HasPrefix(c.PostLoginRedirect, "https://"),
+			"should be https outside local")
+		for _, p := range c.OIDCProviders {
+			add("oidc_"+p.Name+"_redirect_https", strings.HasPrefix(p.RedirectURL, "https://"),
+				"redirect URL should be https outside local")
+		}
+		add("cors_origins", len(c.CORSOrigins) > 0, "CORS_ORIGINS unset, only http://localhost:5002 is allowed")
+	}
+	if c.SMTPHost != "" {
+		_, err := mail.ParseAddress(c.SMTPFrom)
+		add("smtp_from", err == nil, "SMTP_FROM is not a valid address")
+	}
+	add("database_url", c.DatabaseURL != "", "DATABASE_URL unset")
+	return out
+}
+
+func (h *Handler) debugDB(ctx context.Context) debugDB {
+	var out debugDB
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := h.DB.PingContext(ctx)
+	out.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	out.OpenConnections = h.DB.Stats().OpenConnections
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.OK = true
+
+	// golang-migrate bookkeeping, absent if migrations ran elsewhere
+	var version int64
+	var dirty bool
+	if h.DB.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty) == nil {
+		out.MigrationVersion = &version
+		out.MigrationDirty = &dirty
+	}
+	return out
+}
+
+func debugBuildInfo() debugBuild {
+	b := debugBuild{
+		GoVersion: runtime.Version(),
+		Uptime:    time.Since(startedAt).Round(time.Second).String(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		b.Module = bi.Main.Path
+		b.Version = bi.Main.Version
+		b.Settings = map[string]string{}
+		for _, s := range bi.Settings {
+			if strings.HasPrefix(s.Key, "vcs.") || s.Key == "GOOS" || s.Key == "GOARCH" {
+				b.Settings[s.Key] = s.Value
+			}
+		}
+	}
+	return b
+}
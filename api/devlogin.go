@@ -0,0 +1,104 @@
+// api/devlogin.go
+package api
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Dev login issues real sessions without an identity provider, so local
+// runs go through RequireAuth and RequireRole exactly like prod.
+//
+// It only exists with APP_ENV=local (the route is not even registered
+// otherwise) and only answers direct requests from this machine or a
+// private network, never requests that came through a proxy or were
+// addressed to anything but a loopback host.
+
+func (h *Handler) isLocal() bool {
+	return strings.EqualFold(h.Cfg.AppEnv, "local")
+}
+
+// MountDevLogin registers /auth/dev in local mode only.
+func (h *Handler) MountDevLogin(r chi.Router) {
+	if !h.isLocal() {
+		return
+	}
+	log.Printf("auth: APP_ENV=local, dev login enabled at /auth/dev (default %s as %s)",
+		h.Cfg.DevLoginEmail, h.Cfg.DevLoginRole)
+	r.Get("/auth/dev", h.handleDevLogin)
+}
+
+func devLoginAllowed(r *http.Request) bool {
+	if r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != "" {
+		return false
+	}
+	// a public name in Host means the server is reachable from outside,
+	// whatever APP_ENV says
+	reqHost := strings.Trim(r.Host, "[]")
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		reqHost = h
+	}
+	if reqHost == "" || strings.HasPrefix(reqHost, "/") || !isLoopbackHost(reqHost) {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate())
+}
+
+// GET /auth/dev?email=anna@example.com&name=Anna&role=bookkeeper&redirect=/
+// Defaults: DEV_LOGIN_EMAIL / DEV_LOGIN_ROLE. The user is created or updated
+// to the given role and marked active.
+func (h *Handler) handleDevLogin(w http.ResponseWriter, r *http.Request) {
+	if !h.isLocal() || !devLoginAllowed(r) {
+		http.NotFound(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+	email := strings.ToLower(firstNonEmpty(q.Get("email"), h.Cfg.DevLoginEmail))
+	role := firstNonEmpty(q.Get("role"), h.Cfg.DevLoginRole)
+	if _, err := mail.ParseAddress(email); err != nil {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	}
+	if !validRole(role) {
+		http.Error(w, "role must be admin, sales or bookkeeper", http.StatusBadRequest)
+		return
+	}
+
+	var userID int
+	err := h.DB.QueryRow(`
+		INSERT INTO users (email, name, role, status, invited_by, last_login_at)
+		VALUES ($1, NULLIF($2, ''), $3, 'active', 'dev login', now())
+		ON CONFLICT ((lower(email))) DO UPDATE
+		SET role = EXCLUDED.role,
+		    name = COALESCE(EXCLUDED.name, users.name),
+		    status = 'active',
+		    last_login_at = now(),
+		    updated_at = now()
+		RETURNING id`, email, q.Get("name"), role,
+	).Scan(&userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.startSession(w, r, userID); err != nil {
+		http.Error(w, "session failed", http.StatusInternalServerError)
+		return
+	}
+
+	redirectTo := firstNonEmpty(h.Cfg.PostLoginRedirect, "/")
+	if v := q.Get("redirect"); v != "" && h.allowedRedirect(v) {
+		redirectTo = v
+	}
+	http.Redirect(w, r, redirectTo, http.StatusFound)
+}
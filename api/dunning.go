@@ -0,0 +1,305 @@
+// api/dunning.go
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Dunning levels as stored in cashflow_entries.dunning_level / dunning_notices.level.
+var dunningLevelNames = map[int]string{
+	0: "none",
+	1: "zahlungserinnerung",
+	2: "mahnung_1",
+	3: "mahnung_2",
+}
+
+type DunningNotice struct {
+	ID              int     `json:"id"`
+	CashflowEntryID int     `json:"cashflow_entry_id"`
+	ContractID      int     `json:"contract_id"`
+	ClientID        int     `json:"client_id"`
+	ClientName      string  `json:"client_name"`
+	Level           int     `json:"level"`
+	LevelName       string  `json:"level_name"`
+	DueDate         string  `json:"due_date"`
+	Amount          float64 `json:"amount"`
+	Fee             float64 `json:"fee"`
+	FeesTotal       float64 `json:"fees_total"` // all fees of this entry so far, incl. this one
+	PayBy           string  `json:"pay_by"`
+	CreatedAt       *string `json:"created_at,omitempty"`
+}
+
+// Tunables (app_settings, value_numeric):
+//
+//	dunning_reminder_days  days after due date before the Zahlungserinnerung (default 7)
+//	dunning_interval_days  days between two notices (default 14)
+//	dunning_payment_days   payment deadline printed on the notice (default 7)
+//	dunning_fee_1..3       fee per level in EUR (defaults 0 / 5 / 10)
+type dunningConfig struct {
+	ReminderDays int
+	IntervalDays int
+	PaymentDays  int
+	Fees         [4]float64 // index = level
+}
+
+func (h *Handler) loadDunningConfig() dunningConfig {
+	return dunningConfig{
+		ReminderDays: int(h.getNumericSetting("dunning_reminder_days", 7)),
+		IntervalDays: int(h.getNumericSetting("dunning_interval_days", 14)),
+		PaymentDays:  int(h.getNumericSetting("dunning_payment_days", 7)),
+		Fees: [4]float64{
+			0,
+			h.getNumericSetting("dunning_fee_1", 0),
+			h.getNumericSetting("dunning_fee_2", 5),
+			h.getNumericSetting("dunning_fee_3", 10),
+		},
+	}
+}
+
+/*
+	POST /api/dunning/run[?dry_run=true]
+
+Marks pending entries past their due date as overdue and escalates every
+overdue entry whose interval has elapsed to the next dunning level, storing
+the rendered notice. With dry_run nothing is written.
+*/
+func (h *Handler) RunDunning(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	cfg := h.loadDunningConfig()
+	today := time.Now()
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "begin tx: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE cashflow_entries
+		SET status = 'overdue'
+		WHERE status = 'pending' AND due_date < current_date`); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := tx.Query(`
+		SELECT
+			cf.id,
+			cf.contract_id,
+			cl.id,
+			cl.name,
+			cf.dunning_level + 1,
+			to_char(cf.due_date, 'YYYY-MM-DD'),
+			cf.amount,
+			COALESCE((SELECT SUM(fee) FROM dunning_notices dn WHERE dn.cashflow_entry_id = cf.id), 0)
+		FROM cashflow_entries cf
+		JOIN contracts c ON c.id = cf.contract_id
+		JOIN clients cl  ON cl.id = c.client_id
+		WHERE cf.status = 'overdue'
+		  AND cf.dunning_level < 3
+		  AND (
+		    (cf.dunning_level = 0 AND cf.due_date + $1::int <= current_date)
+		    OR
+		    (cf.dunning_level > 0 AND cf.last_dunned_at + $2::int <= current_date)
+		  )
+		ORDER BY cf.due_date, cf.id
+		FOR UPDATE OF cf`, cfg.ReminderDays, cfg.IntervalDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	notices := []DunningNotice{}
+	for rows.Next() {
+		var n DunningNotice
+		var prevFees float64
+		if err := rows.Scan(&n.CashflowEntryID, &n.ContractID, &n.ClientID, &n.ClientName,
+			&n.Level, &n.DueDate, &n.Amount, &prevFees); err != nil {
+			rows.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n.LevelName = dunningLevelNames[n.Level]
+		n.Fee = cfg.Fees[n.Level]
+		n.FeesTotal = prevFees + n.Fee
+		n.PayBy = today.AddDate(0, 0, cfg.PaymentDays).Format("2006-01-02")
+		notices = append(notices, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !dryRun {
+		company := h.getTextSetting("company_name", h.getTextSetting("sepa_creditor_name", ""))
+		for i := range notices {
+			n := &notices[i]
+			doc, err := renderDunningDocument(company, *n)
+			if err != nil {
+				http.Error(w, "render notice: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := tx.QueryRow(`
+				INSERT INTO dunning_notices (cashflow_entry_id, level, fee, pay_by, document)
+				VALUES ($1, $2, $3, $4::date, $5)
+				RETURNING id, to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')`,
+				n.CashflowEntryID, n.Level, n.Fee, n.PayBy, doc,
+			).Scan(&n.ID, &n.CreatedAt); err != nil {
+				http.Error(w, "insert notice: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if _, err := tx.Exec(`
+				UPDATE cashflow_entries
+				SET dunning_level = $1, last_dunned_at = current_date
+				WHERE id = $2`, n.Level, n.CashflowEntryID,
+			); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, n := range notices {
+			h.notifyPaymentReminder(n)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(notices)
+}
+
+// GET /api/dunning/notices?contract_id=&entry_id=&level=
+func (h *Handler) ListDunningNotices(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	contractID, _ := strconv.Atoi(q.Get("contract_id"))
+	entryID, _ := strconv.Atoi(q.Get("entry_id"))
+	level, _ := strconv.Atoi(q.Get("level"))
+
+	rows, err := h.DB.Query(`
+		SELECT
+			dn.id,
+			dn.cashflow_entry_id,
+			cf.contract_id,
+			cl.id,
+			cl.name,
+			dn.level,
+			to_char(cf.due_date, 'YYYY-MM-DD'),
+			cf.amount,
+			dn.fee,
+			(SELECT SUM(x.fee) FROM dunning_notices x
+			  WHERE x.cashflow_entry_id = dn.cashflow_entry_id AND x.level <= dn.level),
+			to_char(dn.pay_by, 'YYYY-MM-DD'),
+			to_char(dn.created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')
+		FROM dunning_notices dn
+		JOIN cashflow_entries cf ON cf.id = dn.cashflow_entry_id
+		JOIN contracts c         ON c.id = cf.contract_id
+		JOIN clients cl          ON cl.id = c.client_id
+		WHERE ($1 = 0 OR cf.contract_id = $1)
+		  AND ($2 = 0 OR dn.cashflow_entry_id = $2)
+		  AND ($3 = 0 OR dn.level = $3)
+		ORDER BY dn.created_at DESC, dn.id DESC`, contractID, entryID, level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []DunningNotice{}
+	for rows.Next() {
+		var n DunningNotice
+		if err := rows.Scan(&n.ID, &n.CashflowEntryID, &n.ContractID, &n.ClientID, &n.ClientName,
+			&n.Level, &n.DueDate, &n.Amount, &n.Fee, &n.FeesTotal, &n.PayBy, &n.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n.LevelName = dunningLevelNames[n.Level]
+		out = append(out, n)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// GET /api/dunning/notices/{id}/document  -> printable HTML letter
+func (h *Handler) GetDunningDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid notice id", http.StatusBadRequest)
+		return
+	}
+
+	var doc string
+	err = h.DB.QueryRow(`SELECT document FROM dunning_notices WHERE id = $1`, id).Scan(&doc)
+	if err == sql.ErrNoRows {
+		http.Error(w, "notice not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(doc))
+}
+
+/* ------------ Notice document ------------ */
+
+var dunningTitles = map[int]string{
+	1: "Zahlungserinnerung",
+	2: "1. Mahnung",
+	3: "2. Mahnung",
+}
+
+var dunningTemplate = template.Must(template.New("dunning").Funcs(template.FuncMap{
+	"eur": func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) + " €" },
+}).Parse(`<!doctype html>
+<html lang="de">
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<body>
+<p>{{.Company}}</p>
+<p>{{.N.ClientName}}</p>
+<p>{{.Date}}</p>
+<h1>{{.Title}}</h1>
+<p>Guten Tag {{.N.ClientName}},</p>
+{{if eq .N.Level 1}}
+<p>sicher ist es Ihrer Aufmerksamkeit entgangen: Die folgende Rate aus Vertrag Nr. {{.N.ContractID}} ist noch offen.</p>
+{{else}}
+<p>leider konnten wir trotz unserer Erinnerung noch keinen Zahlungseingang für die folgende Rate aus Vertrag Nr. {{.N.ContractID}} feststellen.</p>
+{{end}}
+<table>
+<tr><td>Fällig seit</td><td>{{.N.DueDate}}</td></tr>
+<tr><td>Offener Betrag</td><td>{{eur .N.Amount}}</td></tr>
+{{if gt .N.FeesTotal 0.0}}<tr><td>Mahngebühren</td><td>{{eur .N.FeesTotal}}</td></tr>{{end}}
+<tr><td><strong>Gesamt</strong></td><td><strong>{{eur .Total}}</strong></td></tr>
+</table>
+<p>Bitte überweisen Sie den Gesamtbetrag bis spätestens {{.N.PayBy}}.</p>
+<p>Sollten Sie die Zahlung bereits veranlasst haben, betrachten Sie dieses Schreiben bitte als gegenstandslos.</p>
+</body>
+</html>
+`))
+
+func renderDunningDocument(company string, n DunningNotice) (string, error) {
+	var buf bytes.Buffer
+	err := dunningTemplate.Execute(&buf, map[string]any{
+		"Title":   dunningTitles[n.Level],
+		"Company": company,
+		"Date":    time.Now().Format("02.01.2006"),
+		"N":       n,
+		"Total":   n.Amount + n.FeesTotal,
+	})
+	return buf.String(), err
+}
@@ -0,0 +1,360 @@
+// api/email.go
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type EmailTemplate struct {
+	Key         string  `json:"key"`
+	Description *string `json:"description,omitempty"`
+	Subject     string  `json:"subject"`
+	BodyHTML    string  `json:"body_html"`
+	UpdatedAt   *string `json:"updated_at,omitempty"`
+}
+
+type EmailOutboxEntry struct {
+	ID          int     `json:"id"`
+	TemplateKey string  `json:"template_key"`
+	ToAddress   string  `json:"to_address"`
+	ClientID    *int    `json:"client_id,omitempty"`
+	Subject     string  `json:"subject"`
+	Status      string  `json:"status"` // queued | sending | sent | failed
+	Attempts    int     `json:"attempts"`
+	LastError   *string `json:"last_error,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+	SentAt      *string `json:"sent_at,omitempty"`
+}
+
+// GET /api/email/templates
+func (h *Handler) ListEmailTemplates(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(`
+		SELECT key, description, subject, body_html,
+		       to_char(updated_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')
+		FROM email_templates
+		ORDER BY key`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []EmailTemplate{}
+	for rows.Next() {
+		var t EmailTemplate
+		if err := rows.Scan(&t.Key, &t.Description, &t.Subject, &t.BodyHTML, &t.UpdatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// PUT /api/email/templates/{key}
+// Body: { "subject": "...", "body_html": "...", "description": "..." }
+// Both templates are parsed before saving so a typo can't break the queue.
+func (h *Handler) UpsertEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+
+	var t EmailTemplate
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(t.Subject) == "" || strings.TrimSpace(t.BodyHTML) == "" {
+		http.Error(w, "subject and body_html are required", http.StatusBadRequest)
+		return
+	}
+	if _, _, err := parseMailTemplate(t.Subject, t.BodyHTML); err != nil {
+		http.Error(w, "invalid template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t.Key = key
+	err := h.DB.QueryRow(`
+		INSERT INTO email_templates (key, description, subject, body_html, updated_at)
+		VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (key) DO UPDATE
+		SET description = COALESCE(EXCLUDED.description, email_templates.description),
+		    subject     = EXCLUDED.subject,
+		    body_html   = EXCLUDED.body_html,
+		    updated_at  = now()
+		RETURNING description, to_char(updated_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')`,
+		key, t.Description, t.Subject, t.BodyHTML,
+	).Scan(&t.Description, &t.UpdatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(t)
+}
+
+// GET /api/email/outbox?status=failed&client_id=3
+func (h *Handler) ListEmailOutbox(w http.ResponseWriter, r *http.Request) {
+	clientID, _ := strconv.Atoi(r.URL.Query().Get("client_id"))
+	h.writeEmailOutbox(w, r.URL.Query().Get("status"), clientID)
+}
+
+// GET /api/clients/{id}/emails
+func (h *Handler) ListClientEmails(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid client id", http.StatusBadRequest)
+		return
+	}
+	h.writeEmailOutbox(w, "", clientID)
+}
+
+// POST /api/email/outbox/{id}/retry  -> re-queue a failed mail
+func (h *Handler) RetryEmail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid email id", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.DB.Exec(`
+		UPDATE email_outbox
+		SET status = 'queued', attempts = 0, next_attempt_at = now()
+		WHERE id = $1 AND status = 'failed'`, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "no failed email with this id", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) writeEmailOutbox(w http.ResponseWriter, status string, clientID int) {
+	rows, err := h.DB.Query(`
+		SELECT id, template_key, to_address, client_id, subject, status, attempts, last_error,
+		       to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ'),
+		       to_char(sent_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')
+		FROM email_outbox
+		WHERE ($1 = '' OR status = $1)
+		  AND ($2 = 0 OR client_id = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT 500`, status, clientID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []EmailOutboxEntry{}
+	for rows.Next() {
+		var e EmailOutboxEntry
+		if err := rows.Scan(&e.ID, &e.TemplateKey, &e.ToAddress, &e.ClientID, &e.Subject, &e.Status,
+			&e.Attempts, &e.LastError, &e.CreatedAt, &e.SentAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+/* ------------ Triggers ------------ */
+
+// notifyDealWon queues the internal alert for a closed-won sales process.
+func (h *Handler) notifyDealWon(salesProcessID int, req SalesProcessUpdateRequest) {
+	var clientID int
+	var name string
+	if err := h.DB.QueryRow(`
+		SELECT cl.id, cl.name FROM sales_process sp
+		JOIN clients cl ON cl.id = sp.client_id
+		WHERE sp.id = $1`, salesProcessID).Scan(&clientID, &name); err != nil {
+		log.Printf("mail: deal_won #%d: %v", salesProcessID, err)
+		return
+	}
+	data := map[string]any{
+		"ClientName":     name,
+		"Revenue":        formatEUR(req.Revenue),
+		"DurationMonths": derefInt(req.ContractDurationMonths),
+		"Frequency":      derefString(req.ContractFrequency),
+		"StartDate":      derefString(req.ContractStartDate),
+	}
+	for _, to := range h.Cfg.AlertEmails {
+		dedupe := fmt.Sprintf("deal_won:%d:%s", salesProcessID, to)
+		if err := h.enqueueMail(h.DB, "deal_won", to, &clientID, dedupe, data); err != nil {
+			log.Printf("mail: deal_won #%d: %v", salesProcessID, err)
+		}
+	}
+}
+
+// notifyPaymentReminder sends the dunning notice to the client by mail.
+func (h *Handler) notifyPaymentReminder(n DunningNotice) {
+	var email sql.NullString
+	if err := h.DB.QueryRow(`SELECT email FROM clients WHERE id = $1`, n.ClientID).Scan(&email); err != nil {
+		log.Printf("mail: payment_reminder notice #%d: %v", n.ID, err)
+		return
+	}
+	if strings.TrimSpace(email.String) == "" {
+		return
+	}
+	data := map[string]any{
+		"Title":      dunningTitles[n.Level],
+		"ClientName": n.ClientName,
+		"ContractID": n.ContractID,
+		"DueDate":    n.DueDate,
+		"Amount":     formatEUR(&n.Amount),
+		"Fees":       formatEURIfPositive(n.FeesTotal),
+		"PayBy":      n.PayBy,
+	}
+	dedupe := fmt.Sprintf("payment_reminder:%d", n.ID)
+	if err := h.enqueueMail(h.DB, "payment_reminder", email.String, &n.ClientID, dedupe, data); err != nil {
+		log.Printf("mail: payment_reminder notice #%d: %v", n.ID, err)
+	}
+}
+
+// enqueueScheduledMails is called by the worker on every tick; dedupe keys
+// make sure each reminder/summary is only queued once.
+func (h *Handler) enqueueScheduledMails(now time.Time) error {
+	// Zweitgespräch reminder: the day before, while the result is still open
+	rows, err := h.DB.Query(`
+		SELECT sp.id, cl.id, cl.name, cl.email, to_char(sp.zweitgespraech_date, 'DD.MM.YYYY')
+		FROM sales_process sp
+		JOIN clients cl ON cl.id = sp.client_id
+		WHERE sp.stage = 'zweitgespraech'
+		  AND sp.zweitgespraech_result IS NULL
+		  AND sp.zweitgespraech_date = $1::date + 1
+		  AND COALESCE(cl.email, '') <> ''`, now.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+	type reminder struct {
+		spID, clientID    int
+		name, email, date string
+	}
+	var reminders []reminder
+	for rows.Next() {
+		var x reminder
+		if err := rows.Scan(&x.spID, &x.clientID, &x.name, &x.email, &x.date); err != nil {
+			rows.Close()
+			return err
+		}
+		reminders = append(reminders, x)
+	}
+	rows.Close()
+	for _, x := range reminders {
+		dedupe := fmt.Sprintf("zweitgespraech_reminder:%d:%s", x.spID, x.date)
+		data := map[string]any{"ClientName": x.name, "Date": x.date}
+		if err := h.enqueueMail(h.DB, "zweitgespraech_reminder", x.email, &x.clientID, dedupe, data); err != nil {
+			return err
+		}
+	}
+
+	// Weekly summary: Mondays, covering the previous 7 days
+	if now.Weekday() != time.Monday || len(h.Cfg.AlertEmails) == 0 {
+		return nil
+	}
+	year, week := now.ISOWeek()
+	label := fmt.Sprintf("%d-W%02d", year, week)
+	s, err := h.weeklySummary(now)
+	if err != nil {
+		return err
+	}
+	s["Week"] = label
+	for _, to := range h.Cfg.AlertEmails {
+		if err := h.enqueueMail(h.DB, "weekly_summary", to, nil, "weekly_summary:"+label+":"+to, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) weeklySummary(now time.Time) (map[string]any, error) {
+	var newClients, dealsWon, overdueCount, upcoming int
+	var revenueWon, paymentsReceived, overdueAmount float64
+	err := h.DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM clients WHERE created_at >= $1::date - 7 AND created_at < $1::date),
+			(SELECT COUNT(*) FROM contracts WHERE created_at >= $1::date - 7 AND created_at < $1::date),
+			(SELECT COALESCE(SUM(revenue_total), 0) FROM contracts WHERE created_at >= $1::date - 7 AND created_at < $1::date),
+			(SELECT COALESCE(SUM(amount), 0) FROM cashflow_entries
+			  WHERE status = 'paid' AND paid_date >= $1::date - 7 AND paid_date < $1::date),
+			(SELECT COUNT(*) FROM cashflow_entries WHERE status = 'overdue'),
+			(SELECT COALESCE(SUM(amount), 0) FROM cashflow_entries WHERE status = 'overdue'),
+			(SELECT COUNT(*) FROM sales_process
+			  WHERE stage = 'zweitgespraech' AND zweitgespraech_date >= $1::date AND zweitgespraech_date < $1::date + 7)`,
+		now.Format("2006-01-02"),
+	).Scan(&newClients, &dealsWon, &revenueWon, &paymentsReceived, &overdueCount, &overdueAmount, &upcoming)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"NewClients":       newClients,
+		"DealsWon":         dealsWon,
+		"RevenueWon":       formatEUR(&revenueWon),
+		"PaymentsReceived": formatEUR(&paymentsReceived),
+		"OverdueCount":     overdueCount,
+		"OverdueAmount":    formatEUR(&overdueAmount),
+		"UpcomingCalls":    upcoming,
+	}, nil
+}
+
+/* ------------ Formatting helpers ------------ */
+
+// formatEUR renders 1234.5 as "1.234,50".
+func formatEUR(v *float64) string {
+	if v == nil {
+		return "0,00"
+	}
+	s := strconv.FormatFloat(*v, 'f', 2, 64)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	intPart, frac := s[:len(s)-3], s[len(s)-2:]
+	var b strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(c)
+	}
+	out := b.String() + "," + frac
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
+
+func formatEURIfPositive(v float64) string {
+	if v <= 0 {
+		return ""
+	}
+	return formatEUR(&v)
+}
+
+func derefInt(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+func derefString(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
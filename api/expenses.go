@@ -0,0 +1,286 @@
+// api/expenses.go
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type Expense struct {
+	ID          int     `json:"id"`
+	Description string  `json:"description"`
+	Category    *string `json:"category,omitempty"`
+	Amount      float64 `json:"amount"`
+	Recurrence  string  `json:"recurrence"` // none | monthly | quarterly | yearly
+	StartDate   string  `json:"start_date"` // YYYY-MM-DD; the date of a one-off expense
+	EndDate     *string `json:"end_date,omitempty"`
+	Active      bool    `json:"active"`
+	CreatedAt   *string `json:"created_at,omitempty"`
+}
+
+type ExpenseOccurrence struct {
+	ExpenseID   int     `json:"expense_id"`
+	Description string  `json:"description"`
+	Category    *string `json:"category,omitempty"`
+	Date        string  `json:"date"`
+	Amount      float64 `json:"amount"`
+}
+
+// expenseOccurrencesCTE expands active expenses into single payments
+// between $1 (inclusive) and $2 (exclusive). The n-th payment is computed
+// from start_date (start + n months), not from the previous one, so a
+// payment on the 31st is due on the last day of shorter months and on the
+// 31st again after them (Jan 31, Feb 28, Mar 31, …).
+const expenseOccurrencesCTE = `
+expense_occ AS (
+  SELECT e.id, e.description, e.category, occ.due_date, e.amount::numeric AS amount
+  FROM expenses e
+  CROSS JOIN LATERAL (
+    SELECT CASE e.recurrence WHEN 'quarterly' THEN 3 WHEN 'yearly' THEN 12 ELSE 1 END AS months,
+           CASE WHEN e.recurrence = 'none' THEN e.start_date
+                ELSE LEAST(COALESCE(e.end_date, $2::date), $2::date) END AS last_date
+  ) p
+  CROSS JOIN LATERAL generate_series(
+         0,
+         -- upper bound on the count; overshoot is filtered below
+         CASE WHEN e.recurrence = 'none' THEN 0
+              ELSE (p.last_date - e.start_date) / 28 / p.months + 1 END
+       ) n
+  CROSS JOIN LATERAL (
+    SELECT (e.start_date + n * p.months * interval '1 month')::date AS due_date
+  ) occ
+  WHERE e.active
+    AND occ.due_date <= p.last_date
+    AND occ.due_date >= $1::date
+    AND occ.due_date <  $2::date
+)`
+
+const expenseColumns = `
+	id, description, category, amount, recurrence,
+	to_char(start_date, 'YYYY-MM-DD'), to_char(end_date, 'YYYY-MM-DD'), active,
+	to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')`
+
+func scanExpense(sc interface{ Scan(...any) error }) (Expense, error) {
+	var e Expense
+	err := sc.Scan(&e.ID, &e.Description, &e.Category, &e.Amount, &e.Recurrence,
+		&e.StartDate, &e.EndDate, &e.Active, &e.CreatedAt)
+	return e, err
+}
+
+// GET /api/expenses?category=&active=true
+func (h *Handler) ListExpenses(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	category := q.Get("category")
+	active := q.Get("active")
+
+	rows, err := h.DB.Query(`
+		SELECT`+expenseColumns+`
+		FROM expenses
+		WHERE ($1 = '' OR category = $1)
+		  AND ($2 = '' OR active = ($2 = 'true'))
+		ORDER BY start_date DESC, id DESC`, category, active)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []Expense{}
+	for rows.Next() {
+		e, err := scanExpense(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+/*
+	POST /api/expenses
+
+Request-Body:
+
+	{
+	  "description": "Assistenz",
+	  "category": "staff",
+	  "amount": 1200,
+	  "recurrence": "monthly",
+	  "start_date": "2025-11-01",
+	  "end_date": null
+	}
+*/
+func (h *Handler) CreateExpense(w http.ResponseWriter, r *http.Request) {
+	e := Expense{Recurrence: "none", Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := validateExpense(e); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	e, err := scanExpense(h.DB.QueryRow(`
+		INSERT INTO expenses (description, category, amount, recurrence, start_date, end_date, active)
+		VALUES ($1, $2, $3, $4, $5::date, $6::date, $7)
+		RETURNING`+expenseColumns,
+		strings.TrimSpace(e.Description), e.Category, e.Amount, e.Recurrence, e.StartDate, e.EndDate, e.Active,
+	))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(e)
+}
+
+// PATCH /api/expenses/{id}
+// Same fields as POST, all optional. Ending a recurring cost: set end_date.
+func (h *Handler) UpdateExpense(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid expense id", http.StatusBadRequest)
+		return
+	}
+
+	cur, err := scanExpense(h.DB.QueryRow(`SELECT`+expenseColumns+` FROM expenses WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		http.Error(w, "expense not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// decode over the current row: omitted fields keep their value
+	e := cur
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e.ID = cur.ID
+	if msg := validateExpense(e); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	e, err = scanExpense(h.DB.QueryRow(`
+		UPDATE expenses
+		SET description = $1, category = $2, amount = $3, recurrence = $4,
+		    start_date = $5::date, end_date = $6::date, active = $7
+		WHERE id = $8
+		RETURNING`+expenseColumns,
+		strings.TrimSpace(e.Description), e.Category, e.Amount, e.Recurrence, e.StartDate, e.EndDate, e.Active, id,
+	))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(e)
+}
+
+// DELETE /api/expenses/{id}
+func (h *Handler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid expense id", http.StatusBadRequest)
+		return
+	}
+	res, err := h.DB.Exec(`DELETE FROM expenses WHERE id = $1`, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "expense not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/expenses/schedule?from=YYYY-MM-DD&to=YYYY-MM-DD
+// Single payments of all active expenses; default window: next 6 months.
+func (h *Handler) ListExpenseSchedule(w http.ResponseWriter, r *http.Request) {
+	from, to, err := dateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	if from == "" {
+		from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+	}
+	// to is inclusive for the caller, the CTE's upper bound is exclusive
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 6, 0)
+	if to != "" {
+		t, _ := time.Parse("2006-01-02", to)
+		end = t.AddDate(0, 0, 1)
+	}
+
+	rows, err := h.DB.Query(`
+		WITH`+expenseOccurrencesCTE+`
+		SELECT id, description, category, to_char(due_date, 'YYYY-MM-DD'), amount
+		FROM expense_occ
+		ORDER BY due_date, id`, from, end.Format("2006-01-02"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []ExpenseOccurrence{}
+	for rows.Next() {
+		var o ExpenseOccurrence
+		if err := rows.Scan(&o.ExpenseID, &o.Description, &o.Category, &o.Date, &o.Amount); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, o)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func validateExpense(e Expense) string {
+	if strings.TrimSpace(e.Description) == "" {
+		return "description is required"
+	}
+	if e.Amount < 0 {
+		return "amount must be >= 0"
+	}
+	switch e.Recurrence {
+	case "none", "monthly", "quarterly", "yearly":
+	default:
+		return "recurrence must be none, monthly, quarterly or yearly"
+	}
+	start, err := time.Parse("2006-01-02", e.StartDate)
+	if err != nil {
+		return "start_date must be YYYY-MM-DD"
+	}
+	if e.EndDate != nil {
+		end, err := time.Parse("2006-01-02", *e.EndDate)
+		if err != nil {
+			return "end_date must be YYYY-MM-DD"
+		}
+		if end.Before(start) {
+			return "end_date must not be before start_date"
+		}
+	}
+	return ""
+}
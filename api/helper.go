@@ -147,3 +147,14 @@ func (h *Handler) getNumericSetting(key string, def float64) float64 {
 	}
 	return def
 }
+
+// getTextSetting returns app_settings.value_text for a key,
+// or the provided default if the key is missing/NULL.
+func (h *Handler) getTextSetting(key string, def string) string {
+	var v sql.NullString
+	_ = h.DB.QueryRow(`SELECT value_text FROM app_settings WHERE key = $1`, key).Scan(&v)
+	if v.Valid {
+		return v.String
+	}
+	return def
+}
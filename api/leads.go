@@ -0,0 +1,439 @@
+// api/leads.go
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// leadInput is a submission after field mapping; form providers name their
+// fields differently, see parseLeadInput.
+type leadInput struct {
+	SubmissionID       string
+	Mode               string // "participant" | "sales_process" | "" (derived)
+	Name               string
+	Email              string
+	Phone              string
+	Source             string
+	StageID            int
+	StageSlug          string
+	ZweitgespraechDate *string
+	Attended           bool
+}
+
+type LeadCaptureResponse struct {
+	SubmissionID   string `json:"submission_id"`
+	Result         string `json:"result"` // participant | sales_process
+	Duplicate      bool   `json:"duplicate"`
+	StageID        *int   `json:"stage_id,omitempty"`
+	ClientID       *int   `json:"client_id,omitempty"`
+	ParticipantID  *int   `json:"participant_id,omitempty"`
+	SalesProcessID *int   `json:"sales_process_id,omitempty"`
+}
+
+const maxLeadBody = 64 << 10
+
+/*
+	POST /hooks/leads
+
+Public endpoint for landing page / form builders. Authenticated by one of
+LEAD_HOOK_TOKENS (Authorization: Bearer or X-Hook-Token). Not accepted in
+the query string, which ends up in access logs.
+Accepts JSON or form-encoded bodies:
+
+	{
+	  "submission_id": "typeform-8f3a",
+	  "name": "Laura Beispiel",
+	  "email": "laura@example.com",
+	  "phone": "01234 5678",
+	  "source": "paid",
+	  "stage": "webinar-oktober"   // or "stage_id": 7
+	}
+
+With a stage and without zweitgespraech_date the lead becomes a stage
+participant, otherwise a sales process is started (StartSalesProcess).
+Leads are deduplicated by email; a repeated submission_id (or
+Idempotency-Key header) returns the stored response.
+*/
+func (h *Handler) CaptureLead(w http.ResponseWriter, r *http.Request) {
+	if !h.validLeadToken(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxLeadBody+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxLeadBody {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	in, err := parseLeadInput(r, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.replayLeadSubmission(w, in.SubmissionID) {
+		return
+	}
+
+	// resolve stage
+	var stageID *int
+	if in.StageID != 0 || in.StageSlug != "" {
+		var id int
+		err := h.DB.QueryRow(`
+			SELECT id FROM stages
+			WHERE ($1 <> 0 AND id = $1) OR ($1 = 0 AND slug = $2)`,
+			in.StageID, in.StageSlug,
+		).Scan(&id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "unknown stage", http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stageID = &id
+	}
+
+	mode := in.Mode
+	if mode == "" {
+		mode = "sales_process"
+		if stageID != nil && in.ZweitgespraechDate == nil {
+			mode = "participant"
+		}
+	}
+	if mode == "participant" && stageID == nil {
+		http.Error(w, "stage or stage_id is required for participants", http.StatusUnprocessableEntity)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "begin tx: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// dedupe by email against existing clients
+	var clientID *int
+	if in.Email != "" {
+		var id int
+		err := tx.QueryRow(`
+			SELECT id FROM clients
+			WHERE lower(email) = lower($1)
+			ORDER BY id
+			LIMIT 1`, in.Email,
+		).Scan(&id)
+		if err != nil && err != sql.ErrNoRows {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err == nil {
+			clientID = &id
+		}
+	}
+
+	resp := LeadCaptureResponse{SubmissionID: in.SubmissionID, Result: mode, StageID: stageID, ClientID: clientID}
+	var (
+		newParticipant *StageParticipantRequest
+		started        *StartSalesProcessResponse
+		newClient      bool
+	)
+
+	switch mode {
+	case "participant":
+		var id int
+		err := tx.QueryRow(`
+			SELECT id FROM stage_participants
+			WHERE stage_id = $1
+			  AND (($2::int IS NOT NULL AND linked_client_id = $2)
+			       OR ($3 <> '' AND lower(lead_email) = lower($3)))
+			ORDER BY id
+			LIMIT 1`, *stageID, clientID, in.Email,
+		).Scan(&id)
+		switch {
+		case err == nil:
+			resp.Duplicate = true
+			if in.Attended {
+				if _, err := tx.Exec(`UPDATE stage_participants SET attended = true WHERE id = $1`, id); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+		case err == sql.ErrNoRows:
+			req := StageParticipantRequest{ClientID: clientID, Attended: in.Attended}
+			if clientID == nil {
+				req.LeadName = nullableString(in.Name)
+				req.LeadEmail = nullableString(in.Email)
+				req.LeadPhone = nullableString(in.Phone)
+			}
+			if id, err = insertStageParticipant(tx, *stageID, req); err != nil {
+				http.Error(w, "insert participant: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			newParticipant = &req
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.ParticipantID = &id
+
+	case "sales_process":
+		if clientID == nil {
+			out, err := startSalesProcessTx(tx, StartSalesProcessRequest{
+				Name:               in.Name,
+				Email:              in.Email,
+				Phone:              in.Phone,
+				Source:             in.Source,
+				SourceStageID:      stageID,
+				ZweitgespraechDate: in.ZweitgespraechDate,
+			})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			started, newClient = &out, true
+			resp.ClientID = &out.Client.ID
+			resp.SalesProcessID = &out.SalesProcessID
+			break
+		}
+
+		// known client: reuse its (single) sales process or open one
+		var spID int
+		err := tx.QueryRow(`SELECT id FROM sales_process WHERE client_id = $1`, *clientID).Scan(&spID)
+		switch {
+		case err == nil:
+			resp.Duplicate = true
+			if _, err := tx.Exec(`
+				UPDATE sales_process
+				SET zweitgespraech_date = $1, updated_at = now()
+				WHERE id = $2 AND zweitgespraech_date IS NULL AND $1::date IS NOT NULL`,
+				in.ZweitgespraechDate, spID,
+			); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case err == sql.ErrNoRows:
+			if err := tx.QueryRow(`
+				INSERT INTO sales_process (client_id, stage, zweitgespraech_date, stage_id)
+				VALUES ($1, 'zweitgespraech', $2, $3)
+				RETURNING id`, *clientID, in.ZweitgespraechDate, stageID,
+			).Scan(&spID); err != nil {
+				http.Error(w, "insert sales_process: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			out := StartSalesProcessResponse{SalesProcessID: spID}
+			out.Client.ID = *clientID
+			out.Client.Name = in.Name
+			out.SalesProcess = StartSalesProcessDTO{ID: spID, ClientID: *clientID, Stage: "zweitgespraech"}
+			started = &out
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.SalesProcessID = &spID
+
+	default:
+		http.Error(w, "mode must be participant or sales_process", http.StatusBadRequest)
+		return
+	}
+
+	stored, _ := json.Marshal(resp)
+	res, err := tx.Exec(`
+		INSERT INTO lead_submissions (submission_id, result, client_id, participant_id, sales_process_id, response)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (submission_id) DO NOTHING`,
+		in.SubmissionID, resp.Result, resp.ClientID, resp.ParticipantID, resp.SalesProcessID, stored,
+	)
+	if err != nil {
+		http.Error(w, "store submission: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// a concurrent request with the same submission id won
+		_ = tx.Rollback()
+		if !h.replayLeadSubmission(w, in.SubmissionID) {
+			http.Error(w, "submission conflict", http.StatusConflict)
+		}
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if newParticipant != nil {
+		h.emitParticipantAdded(*resp.ParticipantID, *stageID, *newParticipant)
+	}
+	if started != nil {
+		h.emitSalesStarted(*started, newClient)
+	}
+
+	status := http.StatusCreated
+	if resp.Duplicate {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(stored)
+}
+
+func (h *Handler) validLeadToken(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	token = firstNonEmpty(strings.TrimSpace(token), r.Header.Get("X-Hook-Token"))
+	if token == "" {
+		return false
+	}
+	ok := false
+	for _, t := range h.Cfg.LeadHookTokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// replayLeadSubmission writes the stored response of an already processed
+// submission and reports whether there was one.
+func (h *Handler) replayLeadSubmission(w http.ResponseWriter, submissionID string) bool {
+	var stored []byte
+	err := h.DB.QueryRow(
+		`SELECT response FROM lead_submissions WHERE submission_id = $1`, submissionID,
+	).Scan(&stored)
+	if err != nil {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(stored)
+	return true
+}
+
+// parseLeadInput maps JSON or form fields (first match wins) onto leadInput.
+func parseLeadInput(r *http.Request, body []byte) (leadInput, error) {
+	fields := map[string]string{}
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ct {
+	case "application/x-www-form-urlencoded":
+		vals, err := url.ParseQuery(string(body))
+		if err != nil {
+			return leadInput{}, fmt.Errorf("invalid form: %w", err)
+		}
+		for k, v := range vals {
+			if len(v) > 0 {
+				fields[strings.ToLower(k)] = strings.TrimSpace(v[0])
+			}
+		}
+	default:
+		var m map[string]any
+		if err := json.Unmarshal(body, &m); err != nil {
+			return leadInput{}, fmt.Errorf("invalid JSON: %w", err)
+		}
+		for k, v := range m {
+			switch v := v.(type) {
+			case nil:
+			case string:
+				fields[strings.ToLower(k)] = strings.TrimSpace(v)
+			default:
+				fields[strings.ToLower(k)] = strings.TrimSpace(fmt.Sprint(v))
+			}
+		}
+	}
+	get := func(keys ...string) string {
+		for _, k := range keys {
+			if v := fields[k]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	in := leadInput{
+		Mode:  get("mode", "type"),
+		Name:  get("name", "full_name", "fullname", "lead_name"),
+		Email: get("email", "e-mail", "e_mail", "lead_email"),
+		Phone: get("phone", "tel", "telephone", "mobile", "lead_phone"),
+	}
+	if in.Name == "" {
+		in.Name = strings.TrimSpace(get("first_name", "firstname", "vorname") + " " + get("last_name", "lastname", "nachname"))
+	}
+	if in.Email != "" {
+		addr, err := mail.ParseAddress(in.Email)
+		if err != nil {
+			return leadInput{}, fmt.Errorf("invalid email %q", in.Email)
+		}
+		in.Email = strings.ToLower(addr.Address)
+	}
+	if in.Name == "" {
+		in.Name = in.Email
+	}
+	if in.Name == "" {
+		return leadInput{}, fmt.Errorf("name or email is required")
+	}
+	if in.Mode != "" && in.Mode != "participant" && in.Mode != "sales_process" {
+		return leadInput{}, fmt.Errorf("mode must be participant or sales_process")
+	}
+
+	switch src := strings.ToLower(get("source", "utm_medium")); src {
+	case "paid", "cpc", "ppc", "paid_social", "paidsocial", "ads":
+		in.Source = "paid"
+	default:
+		in.Source = "organic"
+	}
+
+	if v := get("stage_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return leadInput{}, fmt.Errorf("invalid stage_id %q", v)
+		}
+		in.StageID = id
+	}
+	in.StageSlug = slugify(get("stage", "stage_slug"))
+
+	if v := get("zweitgespraech_date", "appointment_date"); v != "" {
+		d, err := parseLooseDate(strings.SplitN(v, "T", 2)[0])
+		if err != nil {
+			return leadInput{}, err
+		}
+		in.ZweitgespraechDate = &d
+	}
+	if v := get("attended"); v != "" {
+		in.Attended, _ = strconv.ParseBool(v)
+	}
+
+	in.SubmissionID = firstNonEmpty(
+		get("submission_id", "submissionid", "event_id", "response_id"),
+		strings.TrimSpace(r.Header.Get("Idempotency-Key")),
+	)
+	if in.SubmissionID == "" {
+		// no id from the provider: identical bodies count as the same submission
+		sum := sha256.Sum256(body)
+		in.SubmissionID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return in, nil
+}
+
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,294 @@
+// api/mail.go
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// MailTransport delivers one RFC 5322 message. SMTPTransport is the real
+// implementation; anything speaking SMTP on localhost works for testing.
+type MailTransport interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+type SMTPTransport struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	Timeout  time.Duration // dial plus the whole conversation; default 30s
+}
+
+func (t *SMTPTransport) Send(from string, to []string, msg []byte) error {
+	timeout := t.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	addr := net.JoinHostPort(t.Host, t.Port)
+	dialer := &net.Dialer{Timeout: timeout}
+	tlsConfig := &tls.Config{ServerName: t.Host}
+
+	var conn net.Conn
+	var err error
+	if t.Port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig) // implicit TLS (SMTPS)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	// a server that stops answering must not block the worker
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	// what smtp.SendMail does: STARTTLS when offered, AUTH when configured
+	if t.Port != "465" {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if t.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", t.Username, t.Password, t.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(msg); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+const (
+	maxMailAttempts  = 6
+	mailPollInterval = 30 * time.Second
+	mailClaimTimeout = 30 * time.Minute
+)
+
+// StartMailWorker sends queued mails and enqueues the scheduled ones
+// (zweitgespraech reminders, weekly summary) until ctx is done.
+func (h *Handler) StartMailWorker(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(mailPollInterval)
+		defer t.Stop()
+		for {
+			if err := h.enqueueScheduledMails(time.Now()); err != nil {
+				log.Printf("mail: schedule: %v", err)
+			}
+			if err := h.processMailQueue(ctx); err != nil {
+				log.Printf("mail: queue: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// processMailQueue sends due mails. Failures are retried with exponential
+// backoff (1, 2, 4, 8, 16 min) and marked failed after maxMailAttempts.
+//
+// Rows are claimed (status 'sending') and committed before anything is
+// sent, and each result is written on its own, so a failing update can
+// never put an already delivered mail back into the queue. A claim that is
+// not resolved within mailClaimTimeout (worker died mid-send) is picked up
+// again.
+func (h *Handler) processMailQueue(ctx context.Context) error {
+	if h.Mailer == nil {
+		return nil
+	}
+	from, err := mail.ParseAddress(h.Cfg.SMTPFrom)
+	if err != nil {
+		return fmt.Errorf("SMTP_FROM: %w", err)
+	}
+
+	rows, err := h.DB.QueryContext(ctx, `
+		UPDATE email_outbox
+		SET status = 'sending',
+		    attempts = attempts + 1,
+		    next_attempt_at = now() + make_interval(secs => $1)
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status IN ('queued','sending') AND next_attempt_at <= now()
+			ORDER BY next_attempt_at, id
+			LIMIT 20
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, to_address, subject, body_html, attempts`, mailClaimTimeout.Seconds())
+	if err != nil {
+		return err
+	}
+	type queued struct {
+		id                int
+		to, subject, body string
+		attempts          int // including this one
+	}
+	var batch []queued
+	for rows.Next() {
+		var q queued
+		if err := rows.Scan(&q.id, &q.to, &q.subject, &q.body, &q.attempts); err != nil {
+			rows.Close()
+			return err
+		}
+		batch = append(batch, q)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, q := range batch {
+		msg := buildMailMessage(from, q.to, q.subject, q.body)
+		sendErr := h.Mailer.Send(from.Address, []string{q.to}, msg)
+		if sendErr == nil {
+			_, err = h.DB.ExecContext(ctx, `
+				UPDATE email_outbox
+				SET status = 'sent', sent_at = now(), last_error = NULL
+				WHERE id = $1`, q.id)
+		} else {
+			log.Printf("mail: send #%d to %s failed: %v", q.id, q.to, sendErr)
+			status := "queued"
+			if q.attempts >= maxMailAttempts {
+				status = "failed"
+			}
+			_, err = h.DB.ExecContext(ctx, `
+				UPDATE email_outbox
+				SET status = $1,
+				    last_error = $2,
+				    next_attempt_at = now() + make_interval(mins => $3)
+				WHERE id = $4`, status, sendErr.Error(), 1<<(q.attempts-1), q.id)
+		}
+		if err != nil {
+			// the claim expires and the mail is retried
+			log.Printf("mail: update #%d: %v", q.id, err)
+		}
+	}
+	return nil
+}
+
+func buildMailMessage(from *mail.Address, to, subject, html string) []byte {
+	var b bytes.Buffer
+	domain := "localhost"
+	if i := strings.LastIndex(from.Address, "@"); i >= 0 {
+		domain = from.Address[i+1:]
+	}
+	fmt.Fprintf(&b, "From: %s\r\n", from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", randHex(12), domain)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	_, _ = qp.Write([]byte(html))
+	_ = qp.Close()
+	return b.Bytes()
+}
+
+// execer is satisfied by *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// enqueueMail renders template key with data and queues it for to.
+// A non-empty dedupe key makes repeated triggers a no-op.
+func (h *Handler) enqueueMail(ex execer, key, to string, clientID *int, dedupe string, data any) error {
+	addr, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("recipient %q: %w", to, err)
+	}
+	to = addr.Address
+
+	var subjectSrc, bodySrc string
+	if err := h.DB.QueryRow(
+		`SELECT subject, body_html FROM email_templates WHERE key = $1`, key,
+	).Scan(&subjectSrc, &bodySrc); err != nil {
+		return fmt.Errorf("template %s: %w", key, err)
+	}
+	subject, body, err := renderMailTemplate(subjectSrc, bodySrc, data)
+	if err != nil {
+		return fmt.Errorf("template %s: %w", key, err)
+	}
+
+	_, err = ex.Exec(`
+		INSERT INTO email_outbox (template_key, to_address, client_id, subject, body_html, dedupe_key)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		ON CONFLICT (dedupe_key) DO NOTHING`,
+		key, to, clientID, subject, body, dedupe,
+	)
+	return err
+}
+
+func parseMailTemplate(subjectSrc, bodySrc string) (*template.Template, *htmltemplate.Template, error) {
+	st, err := template.New("subject").Parse(subjectSrc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("subject: %w", err)
+	}
+	bt, err := htmltemplate.New("body").Parse(bodySrc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("body: %w", err)
+	}
+	return st, bt, nil
+}
+
+func renderMailTemplate(subjectSrc, bodySrc string, data any) (string, string, error) {
+	st, bt, err := parseMailTemplate(subjectSrc, bodySrc)
+	if err != nil {
+		return "", "", err
+	}
+	var subject, body bytes.Buffer
+	if err := st.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+	if err := bt.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+	// headers cannot carry line breaks
+	return strings.Join(strings.Fields(subject.String()), " "), body.String(), nil
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bufio"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP is a minimal plain-text SMTP server on 127.0.0.1 that records
+// what it receives. With hang set it accepts connections and never answers.
+type fakeSMTP struct {
+	ln   net.Listener
+	hang bool
+
+	mu   sync.Mutex
+	from string
+	rcpt []string
+	data string
+}
+
+func newFakeSMTP(t *testing.T, hang bool) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln, hang: hang}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) hostPort() (string, string) {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	return host, port
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	if s.hang {
+		_, _ = conn.Read(make([]byte, 1)) // until the client gives up
+		return
+	}
+	rd := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 fake ESMTP")
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		switch up := strings.ToUpper(cmd); {
+		case strings.HasPrefix(up, "EHLO"), strings.HasPrefix(up, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(up, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = strings.Trim(cmd[len("MAIL FROM:"):], "<>")
+			s.mu.Unlock()
+			reply("250 ok")
+		case strings.HasPrefix(up, "RCPT TO:"):
+			s.mu.Lock()
+			s.rcpt = append(s.rcpt, strings.Trim(cmd[len("RCPT TO:"):], "<>"))
+			s.mu.Unlock()
+			reply("250 ok")
+		case up == "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				l, err := rd.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = b.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case up == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPTransportSend(t *testing.T) {
+	srv := newFakeSMTP(t, false)
+	host, port := srv.hostPort()
+	tr := &SMTPTransport{Host: host, Port: port, Timeout: 5 * time.Second}
+
+	from := &mail.Address{Name: "Anna", Address: "anna@example.com"}
+	msg := buildMailMessage(from, "max@example.com", "Dein Zweitgespräch", "<p>Hallo Max</p>")
+	if err := tr.Send(from.Address, []string{"max@example.com"}, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.from != "anna@example.com" {
+		t.Errorf("MAIL FROM = %q", srv.from)
+	}
+	if len(srv.rcpt) != 1 || srv.rcpt[0] != "max@example.com" {
+		t.Errorf("RCPT TO = %v", srv.rcpt)
+	}
+	for _, want := range []string{"To: max@example.com", "Subject: =?utf-8?q?Dein_Zweitgespr=C3=A4ch?=", "<p>Hallo Max</p>"} {
+		if !strings.Contains(srv.data, want) {
+			t.Errorf("message lacks %q:\n%s", want, srv.data)
+		}
+	}
+}
+
+func TestSMTPTransportTimeout(t *testing.T) {
+	srv := newFakeSMTP(t, true)
+	host, port := srv.hostPort()
+	tr := &SMTPTransport{Host: host, Port: port, Timeout: 200 * time.Millisecond}
+
+	done := make(chan error, 1)
+	go func() { done <- tr.Send("anna@example.com", []string{"max@example.com"}, []byte("x")) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("send to a hung server succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("send to a hung server did not time out")
+	}
+}
@@ -0,0 +1,428 @@
+// api/oidc.go
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// OIDCProviderConfig describes one sign-in provider. Endpoints and keys
+// come from <Issuer>/.well-known/openid-configuration.
+type OIDCProviderConfig struct {
+	Name         string // URL segment: /auth/<name>, /auth/<name>/callback
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string // default openid, email, profile
+
+	// claims mapping; defaults "email" and "name"
+	EmailClaim string
+	NameClaim  string
+	// required (default): the EmailVerifiedClaim must be true
+	// if_present: only a present false is refused
+	// ignore: never checked
+	// Multi-tenant issuers ({tenantid} in the discovered issuer) need
+	// "required" or a Tenants list: any tenant can mint any email there.
+	EmailVerified string
+	// default "email_verified"; Entra ID: "xms_edov" (optional claim)
+	EmailVerifiedClaim string
+	// {tenantid} issuers: accepted tid values; empty accepts any tenant
+	Tenants []string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider discovers lazily, so a provider that is down at startup
+// doesn't keep the server from booting.
+type OIDCProvider struct {
+	OIDCProviderConfig
+	HTTPClient *http.Client
+
+	mu          sync.Mutex
+	disc        *oidcDiscovery
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// JWKS is refetched for unknown key ids (provider rotated keys), at most
+// this often.
+const jwksMinRefresh = time.Minute
+
+func NewOIDCProvider(cfg OIDCProviderConfig) *OIDCProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if cfg.EmailClaim == "" {
+		cfg.EmailClaim = "email"
+	}
+	if cfg.NameClaim == "" {
+		cfg.NameClaim = "name"
+	}
+	if cfg.EmailVerified == "" {
+		cfg.EmailVerified = "required"
+	}
+	if cfg.EmailVerifiedClaim == "" {
+		cfg.EmailVerifiedClaim = "email_verified"
+	}
+	return &OIDCProvider{
+		OIDCProviderConfig: cfg,
+		HTTPClient:         &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+func (p *OIDCProvider) discovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.disc != nil {
+		return p.disc, nil
+	}
+	var d oidcDiscovery
+	url := strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, url, &d); err != nil {
+		return nil, fmt.Errorf("oidc %s: discovery: %w", p.Name, err)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc %s: incomplete discovery document", p.Name)
+	}
+	if !issuerMatches(p.Issuer, d.Issuer) {
+		return nil, fmt.Errorf("oidc %s: discovery issuer %q does not match configured %q", p.Name, d.Issuer, p.Issuer)
+	}
+	if strings.Contains(d.Issuer, "{tenantid}") && p.EmailVerified != "required" && len(p.Tenants) == 0 {
+		return nil, fmt.Errorf("oidc %s: multi-tenant issuer needs EMAIL_VERIFIED=required or TENANTS", p.Name)
+	}
+	p.disc = &d
+	return p.disc, nil
+}
+
+// issuerMatches compares the discovered issuer with the configured one.
+// Multi-tenant issuers (Microsoft /common, /organizations) publish
+// ".../{tenantid}/v2.0"; the configured issuer then has one path segment
+// in its place.
+func issuerMatches(configured, discovered string) bool {
+	if discovered == "" {
+		return false
+	}
+	prefix, suffix, templated := strings.Cut(discovered, "{tenantid}")
+	if !templated {
+		return discovered == configured
+	}
+	if !strings.HasPrefix(configured, prefix) || !strings.HasSuffix(configured, suffix) ||
+		len(configured) <= len(prefix)+len(suffix) {
+		return false
+	}
+	return !strings.Contains(configured[len(prefix):len(configured)-len(suffix)], "/")
+}
+
+// OAuth2 returns the code-flow config from the discovered endpoints.
+func (p *OIDCProvider) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	d, err := p.discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  p.RedirectURL,
+		Scopes:       p.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  d.AuthorizationEndpoint,
+			TokenURL: d.TokenEndpoint,
+		},
+	}, nil
+}
+
+// Exchange trades the code using the provider's HTTP client.
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	oc, err := p.OAuth2(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return oc.Exchange(context.WithValue(ctx, oauth2.HTTPClient, p.HTTPClient), code, opts...)
+}
+
+func (p *OIDCProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	d, err := p.discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(p.keysFetched) < jwksMinRefresh {
+		return nil, fmt.Errorf("oidc %s: unknown key %q", p.Name, kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc %s: jwks: %w", p.Name, err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			default:
+				continue
+			}
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+	if k, ok := keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("oidc %s: unknown key %q", p.Name, kid)
+}
+
+// VerifyIDToken checks signature, issuer, audience, lifetime and the nonce
+// sent with the authorization request, and returns the claims.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string) (map[string]any, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed id token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("id token header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("id token signature: %w", err)
+	}
+	pub, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, pub, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("id token claims: %w", err)
+	}
+
+	d, err := p.discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	iss, _ := claims["iss"].(string)
+	if iss == "" {
+		return nil, errors.New("id token has no issuer")
+	}
+	want := d.Issuer
+	if strings.Contains(want, "{tenantid}") {
+		// the tenant comes from the token itself, so it is checked against
+		// the allowed tenants and must form the issuer exactly
+		tid, _ := claims["tid"].(string)
+		if tid == "" || strings.ContainsAny(tid, "/{}") {
+			return nil, errors.New("id token has no valid tenant")
+		}
+		if len(p.Tenants) > 0 && !containsFold(p.Tenants, tid) {
+			return nil, fmt.Errorf("id token tenant %q not allowed", tid)
+		}
+		want = strings.ReplaceAll(want, "{tenantid}", tid)
+	}
+	if iss != want {
+		return nil, fmt.Errorf("id token issuer %q, want %q", iss, want)
+	}
+	if !audienceContains(claims["aud"], p.ClientID) {
+		return nil, errors.New("id token audience mismatch")
+	}
+	// with several audiences the token must name us as authorized party
+	azp, hasAzp := claims["azp"].(string)
+	if aud, ok := claims["aud"].([]any); ok && len(aud) > 1 && !hasAzp {
+		return nil, errors.New("id token has several audiences and no azp")
+	}
+	if hasAzp && azp != p.ClientID {
+		return nil, errors.New("id token azp mismatch")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	if got, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return nil, errors.New("id token nonce mismatch")
+	}
+
+	const leeway = time.Minute
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return nil, errors.New("id token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("id token not yet valid")
+	}
+	return claims, nil
+}
+
+// Identity maps verified claims to email and name per provider config.
+func (p *OIDCProvider) Identity(claims map[string]any) (email, name string, err error) {
+	email, _ = claims[p.EmailClaim].(string)
+	name, _ = claims[p.NameClaim].(string)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" || !strings.Contains(email, "@") {
+		return "", "", fmt.Errorf("claim %q holds no email", p.EmailClaim)
+	}
+
+	verified, present := claims[p.EmailVerifiedClaim]
+	// some issuers send "true" as a string
+	isTrue := verified == true || verified == "true"
+	switch p.EmailVerified {
+	case "ignore":
+	case "if_present":
+		if present && !isTrue {
+			return "", "", errors.New("email not verified")
+		}
+	default:
+		if !isTrue {
+			return "", "", errors.New("email not verified")
+		}
+	}
+	return email, name, nil
+}
+
+func decodeJWTPart(s string, dst any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+func verifyJWTSignature(alg string, pub crypto.PublicKey, signed, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported id token algorithm %q", alg)
+	}
+	hh := hash.New()
+	hh.Write(signed)
+	digest := hh.Sum(nil)
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if alg[:2] != "RS" {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, sig); err != nil {
+			return errors.New("id token signature invalid")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg[:2] != "ES" || len(sig)%2 != 0 {
+			break
+		}
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("id token signature invalid")
+		}
+		return nil
+	}
+	return fmt.Errorf("key does not match algorithm %q", alg)
+}
+
+func containsFold(list []string, v string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func audienceContains(aud any, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []any:
+		for _, a := range v {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,438 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeIssuer is an OIDC provider on httptest: discovery, JWKS and a token
+// endpoint that checks the PKCE verifier of codes handed out by issueCode.
+type fakeIssuer struct {
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	issuer   string // published in discovery; default srv.URL
+	key      *rsa.PrivateKey
+	kid      string
+	jwksHits int
+	codes    map[string]fakeCode
+}
+
+type fakeCode struct {
+	challenge string
+	idToken   string
+}
+
+const fakeClientID = "client-1"
+
+var (
+	fakeKeyOnce sync.Once
+	fakeKeys    [2]*rsa.PrivateKey
+)
+
+// testRSAKey returns one of two keys generated once per test run.
+func testRSAKey(t *testing.T, i int) *rsa.PrivateKey {
+	t.Helper()
+	fakeKeyOnce.Do(func() {
+		for n := range fakeKeys {
+			k, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				panic(err)
+			}
+			fakeKeys[n] = k
+		}
+	})
+	return fakeKeys[i]
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	f := &fakeIssuer{key: testRSAKey(t, 0), kid: "k1", codes: map[string]fakeCode{}}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.srv.Close)
+	f.issuer = f.srv.URL
+	return f
+}
+
+func (f *fakeIssuer) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/.well-known/openid-configuration"):
+		_ = json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                f.issuer,
+			AuthorizationEndpoint: f.srv.URL + "/authorize",
+			TokenEndpoint:         f.srv.URL + "/token",
+			JWKSURI:               f.srv.URL + "/jwks",
+		})
+	case r.URL.Path == "/jwks":
+		f.jwksHits++
+		pub := f.key.PublicKey
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": f.kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}}})
+	case r.URL.Path == "/token":
+		c, ok := f.codes[r.PostFormValue("code")]
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != c.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "at",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     c.idToken,
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// rotate switches the signing key; the JWKS serves only the new one.
+func (f *fakeIssuer) rotate(key *rsa.PrivateKey, kid string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.key, f.kid = key, kid
+}
+
+func (f *fakeIssuer) hits() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.jwksHits
+}
+
+// claims returns a valid claim set for nonce.
+func (f *fakeIssuer) claims(nonce string) map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":            f.srv.URL,
+		"aud":            fakeClientID,
+		"sub":            "user-42",
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"email":          "Anna@Example.com",
+		"email_verified": true,
+		"name":           "Anna",
+	}
+}
+
+// sign returns an RS256 JWT over claims with the current key.
+func (f *fakeIssuer) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	f.mu.Lock()
+	key, kid := f.key, f.kid
+	f.mu.Unlock()
+	return signTestJWT(t, key, kid, claims)
+}
+
+// issueCode registers an authorization code for the PKCE verifier.
+func (f *fakeIssuer) issueCode(code, verifier, idToken string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.codes[code] = fakeCode{challenge: oauth2.S256ChallengeFromVerifier(verifier), idToken: idToken}
+}
+
+func (f *fakeIssuer) provider() *OIDCProvider {
+	return NewOIDCProvider(OIDCProviderConfig{
+		Name:        "fake",
+		Issuer:      f.srv.URL,
+		ClientID:    fakeClientID,
+		RedirectURL: "http://localhost:8080/auth/fake/callback",
+	})
+}
+
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid}) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider()
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		edit    func(c map[string]any)
+		key     *rsa.PrivateKey // signs instead of the issuer's key
+		nonce   string
+		wantErr string
+	}{
+		{name: "valid"},
+		{name: "bad signature", key: testRSAKey(t, 1), wantErr: "signature invalid"},
+		{name: "wrong issuer", edit: func(c map[string]any) { c["iss"] = "https://evil.example" }, wantErr: "issuer"},
+		{name: "empty issuer", edit: func(c map[string]any) { c["iss"] = "" }, wantErr: "no issuer"},
+		{name: "missing issuer", edit: func(c map[string]any) { delete(c, "iss") }, wantErr: "no issuer"},
+		{name: "wrong audience", edit: func(c map[string]any) { c["aud"] = "client-2" }, wantErr: "audience"},
+		{name: "audience list", edit: func(c map[string]any) { c["aud"] = []string{fakeClientID} }},
+		{name: "several audiences without azp", edit: func(c map[string]any) {
+			c["aud"] = []string{"client-2", fakeClientID}
+		}, wantErr: "azp"},
+		{name: "several audiences, azp other client", edit: func(c map[string]any) {
+			c["aud"] = []string{"client-2", fakeClientID}
+			c["azp"] = "client-2"
+		}, wantErr: "azp"},
+		{name: "several audiences, azp us", edit: func(c map[string]any) {
+			c["aud"] = []string{"client-2", fakeClientID}
+			c["azp"] = fakeClientID
+		}},
+		{name: "missing subject", edit: func(c map[string]any) { delete(c, "sub") }, wantErr: "subject"},
+		{name: "missing nonce", edit: func(c map[string]any) { delete(c, "nonce") }, wantErr: "nonce"},
+		{name: "wrong nonce", nonce: "other", wantErr: "nonce"},
+		{name: "expired", edit: func(c map[string]any) {
+			c["exp"] = time.Now().Add(-2 * time.Minute).Unix()
+		}, wantErr: "expired"},
+		{name: "within leeway", edit: func(c map[string]any) {
+			c["exp"] = time.Now().Add(-30 * time.Second).Unix()
+		}},
+		{name: "not yet valid", edit: func(c map[string]any) {
+			c["nbf"] = time.Now().Add(5 * time.Minute).Unix()
+		}, wantErr: "not yet valid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := f.claims("n-1")
+			if tt.edit != nil {
+				tt.edit(c)
+			}
+			raw := f.sign(t, c)
+			if tt.key != nil {
+				raw = signTestJWT(t, tt.key, "k1", c)
+			}
+			nonce := tt.nonce
+			if nonce == "" {
+				nonce = "n-1"
+			}
+			_, err := p.VerifyIDToken(ctx, raw, nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	f := newFakeIssuer(t)
+	f.issuer = "https://evil.example"
+	p := f.provider()
+
+	raw := f.sign(t, f.claims("n"))
+	if _, err := p.VerifyIDToken(context.Background(), raw, "n"); err == nil ||
+		!strings.Contains(err.Error(), "discovery issuer") {
+		t.Fatalf("error = %v, want discovery issuer mismatch", err)
+	}
+	if _, err := p.OAuth2(context.Background()); err == nil {
+		t.Fatal("OAuth2 config from a mismatched discovery document")
+	}
+}
+
+func TestOIDCTenantIssuer(t *testing.T) {
+	f := newFakeIssuer(t)
+	f.issuer = f.srv.URL + "/{tenantid}/v2.0"
+	tenantIss := func(tid string) string { return f.srv.URL + "/" + tid + "/v2.0" }
+
+	t.Run("needs required email or tenants", func(t *testing.T) {
+		p := f.provider()
+		p.Issuer = f.srv.URL + "/common/v2.0"
+		p.EmailVerified = "if_present"
+		if _, err := p.OAuth2(context.Background()); err == nil || !strings.Contains(err.Error(), "multi-tenant") {
+			t.Fatalf("error = %v, want multi-tenant refusal", err)
+		}
+	})
+
+	p := f.provider()
+	p.Issuer = f.srv.URL + "/common/v2.0"
+	p.Tenants = []string{"tenant-a"}
+
+	tests := []struct {
+		name    string
+		tid     any
+		iss     string
+		wantErr string
+	}{
+		{name: "allowed tenant", tid: "tenant-a", iss: tenantIss("tenant-a")},
+		{name: "other tenant", tid: "tenant-b", iss: tenantIss("tenant-b"), wantErr: "not allowed"},
+		{name: "issuer of another tenant", tid: "tenant-a", iss: tenantIss("tenant-b"), wantErr: "issuer"},
+		{name: "template issuer", tid: "tenant-a", iss: f.issuer, wantErr: "issuer"},
+		{name: "no tid", iss: tenantIss("tenant-a"), wantErr: "tenant"},
+		{name: "tid with path", tid: "tenant-a/x", iss: tenantIss("tenant-a/x"), wantErr: "tenant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := f.claims("n")
+			c["iss"] = tt.iss
+			if tt.tid != nil {
+				c["tid"] = tt.tid
+			}
+			_, err := p.VerifyIDToken(context.Background(), f.sign(t, c), "n")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIssuerMatches(t *testing.T) {
+	tests := []struct {
+		configured, discovered string
+		want                   bool
+	}{
+		{"https://accounts.google.com", "https://accounts.google.com", true},
+		{"https://accounts.google.com", "https://evil.example", false},
+		{"https://accounts.google.com", "", false},
+		{"https://login.microsoftonline.com/common/v2.0", "https://login.microsoftonline.com/{tenantid}/v2.0", true},
+		{"https://login.microsoftonline.com/a/b/v2.0", "https://login.microsoftonline.com/{tenantid}/v2.0", false},
+		{"https://login.microsoftonline.com//v2.0", "https://login.microsoftonline.com/{tenantid}/v2.0", false},
+		{"https://evil.example/common/v2.0", "https://login.microsoftonline.com/{tenantid}/v2.0", false},
+	}
+	for _, tt := range tests {
+		if got := issuerMatches(tt.configured, tt.discovered); got != tt.want {
+			t.Errorf("issuerMatches(%q, %q) = %v, want %v", tt.configured, tt.discovered, got, tt.want)
+		}
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider()
+	ctx := context.Background()
+
+	if _, err := p.VerifyIDToken(ctx, f.sign(t, f.claims("n")), "n"); err != nil {
+		t.Fatal(err)
+	}
+	if f.hits() != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", f.hits())
+	}
+
+	f.rotate(testRSAKey(t, 1), "k2")
+	raw := f.sign(t, f.claims("n"))
+
+	// unknown kid right after a fetch: no refetch yet
+	if _, err := p.VerifyIDToken(ctx, raw, "n"); err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Fatalf("error = %v, want unknown key", err)
+	}
+	if f.hits() != 1 {
+		t.Fatalf("JWKS fetched %d times within %s, want 1", f.hits(), jwksMinRefresh)
+	}
+
+	p.mu.Lock()
+	p.keysFetched = time.Now().Add(-2 * jwksMinRefresh)
+	p.mu.Unlock()
+	if _, err := p.VerifyIDToken(ctx, raw, "n"); err != nil {
+		t.Fatalf("after refetch: %v", err)
+	}
+	if f.hits() != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", f.hits())
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider()
+	ctx := context.Background()
+	verifier := oauth2.GenerateVerifier()
+	f.issueCode("code-1", verifier, f.sign(t, f.claims("n")))
+
+	if _, err := p.Exchange(ctx, "code-1", oauth2.VerifierOption(oauth2.GenerateVerifier())); err == nil {
+		t.Fatal("exchange with the wrong PKCE verifier succeeded")
+	}
+	tok, err := p.Exchange(ctx, "code-1", oauth2.VerifierOption(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := tok.Extra("id_token").(string)
+	claims, err := p.VerifyIDToken(ctx, raw, "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	email, name, err := p.Identity(claims)
+	if err != nil || email != "anna@example.com" || name != "Anna" {
+		t.Fatalf("Identity = %q, %q, %v", email, name, err)
+	}
+}
+
+func TestOIDCIdentityEmailVerified(t *testing.T) {
+	absent := struct{}{}
+	tests := []struct {
+		mode     string
+		claim    string
+		verified any // absent: claim not sent
+		ok       bool
+	}{
+		{"required", "", true, true},
+		{"required", "", "true", true},
+		{"required", "", false, false},
+		{"required", "", absent, false},
+		{"if_present", "", true, true},
+		{"if_present", "", false, false},
+		{"if_present", "", "false", false},
+		{"if_present", "", absent, true},
+		{"ignore", "", false, true},
+		{"ignore", "", absent, true},
+		{"required", "xms_edov", true, true},
+		{"required", "xms_edov", absent, false},
+	}
+	for _, tt := range tests {
+		p := NewOIDCProvider(OIDCProviderConfig{EmailVerified: tt.mode, EmailVerifiedClaim: tt.claim})
+		claims := map[string]any{"email": "anna@example.com", "name": "Anna"}
+		if tt.verified != absent {
+			claims[p.EmailVerifiedClaim] = tt.verified
+		}
+		if tt.claim != "" {
+			// the default claim must not count for a custom one
+			claims["email_verified"] = true
+		}
+		_, _, err := p.Identity(claims)
+		if (err == nil) != tt.ok {
+			t.Errorf("mode %s, %s=%v: err = %v, want ok=%v", tt.mode, p.EmailVerifiedClaim, tt.verified, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// api/ratelimit.go
+package api
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a fixed-window counter per key (usually the client IP).
+// State is in memory, so every instance counts on its own.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	key    func(*http.Request) string
+	hits   map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration, key func(*http.Request) string) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, key: key, hits: map[string]*rateWindow{}}
+}
+
+// allow counts one hit for key and reports whether it is within the limit
+// and, if not, how long until the window resets.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if len(l.hits) > 10000 {
+		for k, w := range l.hits {
+			if now.Sub(w.start) >= l.window {
+				delete(l.hits, k)
+			}
+		}
+	}
+
+	w, ok := l.hits[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		l.hits[key] = &rateWindow{start: now, count: 1}
+		return true, 0
+	}
+	w.count++
+	if w.count > l.limit {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+	return true, 0
+}
+
+// Middleware answers 429 with Retry-After once a client exceeds the limit.
+func (l *rateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, retry := l.allow(l.key(r)); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP is the connection address. With TRUST_PROXY it is the
+// right-most X-Forwarded-For hop instead, the one Render's proxy appends
+// for the connection it accepted; everything left of it is sent by the
+// client and can be anything. Without a proxy in front the whole header
+// is client input, so it is only read when configured.
+func (h *Handler) clientIP(r *http.Request) string {
+	if h.Cfg.TrustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			hops := strings.Split(xff, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
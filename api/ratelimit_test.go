@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		trustProxy bool
+		xff        string
+		want       string
+	}{
+		{false, "", "10.1.2.3"},
+		{false, "203.0.113.9", "10.1.2.3"},
+		{true, "", "10.1.2.3"},
+		{true, "203.0.113.9", "203.0.113.9"},
+		{true, "198.51.100.1, 203.0.113.9", "203.0.113.9"},
+		{true, "198.51.100.1, ", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		h := &Handler{Cfg: &Config{TrustProxy: tt.trustProxy}}
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.1.2.3:40000"
+		if tt.xff != "" {
+			r.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if got := h.clientIP(r); got != tt.want {
+			t.Errorf("TrustProxy=%v X-Forwarded-For %q: clientIP = %s, want %s", tt.trustProxy, tt.xff, got, tt.want)
+		}
+	}
+}
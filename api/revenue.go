@@ -0,0 +1,221 @@
+// api/revenue.go
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Revenue is recognized evenly over the service period: revenue_total /
+// duration_months for every month from start_date. A contract terminated
+// early (end_date before start + duration_months) stops after the month of
+// end_date, and that month recognizes whatever of revenue_total is still
+// unrecognized: the contract owes it at termination (PATCH lowers
+// revenue_total if it doesn't), and nothing stays deferred forever. Cash
+// is what was actually collected (paid cashflow_entries, by paid_date).
+//
+// Per contract, collected minus recognized is either deferred revenue
+// (paid in advance) or accrued revenue (service delivered, not yet paid).
+type RevenueRecognitionMonth struct {
+	Month                string  `json:"month"` // YYYY-MM
+	Recognized           float64 `json:"recognized"`
+	CashCollected        float64 `json:"cash_collected"`
+	CumulativeRecognized float64 `json:"cumulative_recognized"`
+	CumulativeCash       float64 `json:"cumulative_cash"`
+	DeferredRevenue      float64 `json:"deferred_revenue"` // balance at month end
+	AccruedRevenue       float64 `json:"accrued_revenue"`  // balance at month end
+}
+
+type RevenueRecognitionReport struct {
+	From                string                    `json:"from"`
+	To                  string                    `json:"to"`
+	RecognizedTotal     float64                   `json:"recognized_total"`
+	CashCollectedTotal  float64                   `json:"cash_collected_total"`
+	Months              []RevenueRecognitionMonth `json:"months"`
+	TerminatedContracts []int                     `json:"terminated_contracts"`
+}
+
+type recognitionContract struct {
+	id             int
+	start          time.Time
+	end            *time.Time
+	durationMonths int
+	revenueTotal   float64
+	cash           map[int]float64 // month index -> collected
+}
+
+// monthIndex numbers months continuously (year*12 + month-1).
+func monthIndex(t time.Time) int { return t.Year()*12 + int(t.Month()) - 1 }
+
+func monthLabel(i int) string { return fmt.Sprintf("%04d-%02d", i/12, i%12+1) }
+
+// maxRecognitionMonths caps the from/to window of one report.
+const maxRecognitionMonths = 120
+
+// GET /api/revenue/recognition?from=YYYY-MM&to=YYYY-MM&contract_id=
+// Default window: the current calendar year, at most 10 years.
+func (h *Handler) RevenueRecognition(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := time.Now()
+	from := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(now.Year(), 12, 1, 0, 0, 0, 0, time.UTC)
+	for _, p := range []struct {
+		key string
+		dst *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if v := q.Get(p.key); v != "" {
+			t, err := time.Parse("2006-01", v)
+			if err != nil {
+				http.Error(w, "from/to must be YYYY-MM", http.StatusBadRequest)
+				return
+			}
+			*p.dst = t
+		}
+	}
+	if to.Before(from) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+	if monthIndex(to)-monthIndex(from) >= maxRecognitionMonths {
+		http.Error(w, "from/to must span at most 10 years", http.StatusBadRequest)
+		return
+	}
+	contractID, _ := strconv.Atoi(q.Get("contract_id"))
+
+	contracts, err := h.loadRecognitionContracts(contractID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fromIdx, toIdx := monthIndex(from), monthIndex(to)
+	report := RevenueRecognitionReport{
+		From:                monthLabel(fromIdx),
+		To:                  monthLabel(toIdx),
+		Months:              make([]RevenueRecognitionMonth, toIdx-fromIdx+1),
+		TerminatedContracts: []int{},
+	}
+	for i := range report.Months {
+		report.Months[i].Month = monthLabel(fromIdx + i)
+	}
+
+	for _, c := range contracts {
+		first := monthIndex(c.start)
+		last := first + c.durationMonths - 1
+		perMonth := c.revenueTotal / float64(c.durationMonths)
+		terminated := c.end != nil && monthIndex(*c.end) < last
+		if terminated {
+			last = monthIndex(*c.end)
+			if last < first {
+				first = last
+			}
+			report.TerminatedContracts = append(report.TerminatedContracts, c.id)
+		}
+
+		// walk from the earliest relevant month so balances carry over
+		startIdx := first
+		for m := range c.cash {
+			if m < startIdx {
+				startIdx = m
+			}
+		}
+		var cumRec, cumCash float64
+		for m := startIdx; m <= toIdx; m++ {
+			var rec float64
+			if m >= first && m <= last {
+				rec = perMonth
+			}
+			if terminated && m == last {
+				rec = c.revenueTotal - perMonth*float64(last-first)
+			}
+			cash := c.cash[m]
+			cumRec += rec
+			cumCash += cash
+			if m < fromIdx {
+				continue
+			}
+			row := &report.Months[m-fromIdx]
+			row.Recognized += rec
+			row.CashCollected += cash
+			row.CumulativeRecognized += cumRec
+			row.CumulativeCash += cumCash
+			if diff := cumCash - cumRec; diff > 0 {
+				row.DeferredRevenue += diff
+			} else {
+				row.AccruedRevenue += -diff
+			}
+		}
+	}
+
+	for i := range report.Months {
+		m := &report.Months[i]
+		m.Recognized = round2(m.Recognized)
+		m.CashCollected = round2(m.CashCollected)
+		m.CumulativeRecognized = round2(m.CumulativeRecognized)
+		m.CumulativeCash = round2(m.CumulativeCash)
+		m.DeferredRevenue = round2(m.DeferredRevenue)
+		m.AccruedRevenue = round2(m.AccruedRevenue)
+		report.RecognizedTotal += m.Recognized
+		report.CashCollectedTotal += m.CashCollected
+	}
+	report.RecognizedTotal = round2(report.RecognizedTotal)
+	report.CashCollectedTotal = round2(report.CashCollectedTotal)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+func (h *Handler) loadRecognitionContracts(contractID int) ([]recognitionContract, error) {
+	rows, err := h.DB.Query(`
+		SELECT id, start_date, end_date, duration_months, revenue_total
+		FROM contracts
+		WHERE ($1 = 0 OR id = $1)
+		ORDER BY id`, contractID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []recognitionContract
+	byID := map[int]int{}
+	for rows.Next() {
+		var c recognitionContract
+		if err := rows.Scan(&c.id, &c.start, &c.end, &c.durationMonths, &c.revenueTotal); err != nil {
+			return nil, err
+		}
+		c.cash = map[int]float64{}
+		byID[c.id] = len(out)
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	crows, err := h.DB.Query(`
+		SELECT contract_id, COALESCE(paid_date, due_date), amount
+		FROM cashflow_entries
+		WHERE status = 'paid'
+		  AND ($1 = 0 OR contract_id = $1)`, contractID)
+	if err != nil {
+		return nil, err
+	}
+	defer crows.Close()
+	for crows.Next() {
+		var id int
+		var d time.Time
+		var amount float64
+		if err := crows.Scan(&id, &d, &amount); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[id]; ok {
+			out[i].cash[monthIndex(d)] += amount
+		}
+	}
+	return out, crows.Err()
+}
+
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
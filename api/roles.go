@@ -0,0 +1,177 @@
+// api/roles.go
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	RoleAdmin      = "admin"
+	RoleSales      = "sales"
+	RoleBookkeeper = "bookkeeper"
+)
+
+var allRoles = []string{RoleAdmin, RoleSales, RoleBookkeeper}
+
+func validRole(role string) bool {
+	for _, r := range allRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type ctxKey int
+
+const (
+	sessionCtxKey ctxKey = iota
+	scopeCtxKey          // area admitted by RequireScope
+)
+
+func withSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionCtxKey, s)
+}
+
+// currentSession is the session RequireAuth put into the request context.
+func currentSession(r *http.Request) *Session {
+	s, _ := r.Context().Value(sessionCtxKey).(*Session)
+	return s
+}
+
+// RequireRole lets safe methods (GET/HEAD) through for read roles and
+// everything else for write roles; other sessions get 403. Must run after
+// RequireAuth, and for token sessions after RequireScope.
+func (h *Handler) RequireRole(read, write []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			sess := currentSession(r)
+			if sess == nil {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if sess.TokenID != 0 && !scopeChecked(r) {
+				http.Error(w, "token scope does not allow this request", http.StatusForbidden)
+				return
+			}
+			allowed := write
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				allowed = read
+			}
+			for _, role := range allowed {
+				if sess.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "forbidden", http.StatusForbidden)
+		})
+	}
+}
+
+// errIdentityConflict: the user is already bound to another account of
+// the same provider.
+var errIdentityConflict = errors.New("user is bound to another account of this provider")
+
+// loginOIDCUser marks an invited or active user as signed in and returns
+// their id. A known issuer+subject signs in its bound user; otherwise the
+// email finds the user, who is then bound to this issuer+subject. Unknown
+// and disabled users get sql.ErrNoRows.
+func (h *Handler) loginOIDCUser(provider, issuer, subject, email, name string) (int, error) {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		UPDATE user_identities SET last_login_at = now()
+		WHERE issuer = $1 AND subject = $2
+		RETURNING user_id`, issuer, subject,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(`
+			SELECT id FROM users
+			WHERE lower(email) = lower($1) AND status <> 'disabled'
+			FOR UPDATE`, email,
+		).Scan(&id)
+		if err != nil {
+			return 0, err
+		}
+		var bound bool
+		if err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM user_identities WHERE user_id = $1 AND provider = $2)`,
+			id, provider,
+		).Scan(&bound); err != nil {
+			return 0, err
+		}
+		if bound {
+			return 0, errIdentityConflict
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO user_identities (user_id, provider, issuer, subject, email, last_login_at)
+			VALUES ($1, $2, $3, $4, lower($5), now())`,
+			id, provider, issuer, subject, email,
+		); err != nil {
+			return 0, err
+		}
+	} else if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow(`
+		UPDATE users
+		SET status = 'active',
+		    name = COALESCE(NULLIF($2, ''), name),
+		    last_login_at = now(),
+		    updated_at = now()
+		WHERE id = $1
+		  AND status <> 'disabled'
+		RETURNING id`, id, name,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (h *Handler) isAdminEmail(email string) bool {
+	for _, e := range h.Cfg.AdminEmails {
+		if strings.EqualFold(e, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// seedUsers runs at startup: ADMIN_EMAILS are always admins so there is a
+// way in, and addresses still listed in the legacy ALLOWED_EMAILS are
+// invited once. Existing users (incl. disabled ones) are left alone.
+func (h *Handler) seedUsers() {
+	for _, e := range h.Cfg.AdminEmails {
+		if _, err := h.DB.Exec(`
+			INSERT INTO users (email, role, invited_by) VALUES (lower($1), 'admin', 'ADMIN_EMAILS')
+			ON CONFLICT ((lower(email))) DO UPDATE SET role = 'admin', updated_at = now()`, e,
+		); err != nil {
+			log.Printf("auth: seed admin %s: %v", e, err)
+		}
+	}
+	for _, e := range h.Cfg.AllowedEmails {
+		if _, err := h.DB.Exec(`
+			INSERT INTO users (email, invited_by) VALUES (lower($1), 'ALLOWED_EMAILS')
+			ON CONFLICT ((lower(email))) DO NOTHING`, e,
+		); err != nil {
+			log.Printf("auth: seed user %s: %v", e, err)
+		}
+	}
+}
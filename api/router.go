@@ -1,10 +1,10 @@
 package api
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
@@ -13,6 +13,17 @@ import (
 
 func NewRouterWithConfig(db *sql.DB, cfg *Config) *chi.Mux {
 	h := &Handler{DB: db, Cfg: cfg}
+	if cfg.SMTPHost != "" {
+		h.Mailer = &SMTPTransport{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		}
+	}
+	h.StartMailWorker(context.Background())
+	h.StartWebhookWorker(context.Background())
+	h.StartAuditPruner(context.Background())
 	r := chi.NewRouter()
 
 	// Middlewares (order matters)
@@ -27,14 +38,9 @@ func NewRouterWithConfig(db *sql.DB, cfg *Config) *chi.Mux {
 		})
 	})
 
-	origins := cfg.CORSOrigins
-	if len(origins) == 0 {
-		origins = []string{"http://localhost:5002"}
-	}
-
 	// CORS must be before routes
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   origins,
+		AllowedOrigins:   h.corsOrigins(),
 		AllowCredentials: true,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
@@ -49,10 +55,12 @@ func NewRouterWithConfig(db *sql.DB, cfg *Config) *chi.Mux {
 	if err := h.InitAuth(); err != nil {
 		panic(err)
 	}
+	h.seedUsers()
 
 	// Public
 	r.Get("/health", h.health)
 	h.MountAuthRoutes(r)
+	h.MountDevLogin(r)
 
 	// ✅ Add this: make backend "/" respond 200 so health probes don't 405
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
@@ -61,61 +69,177 @@ func NewRouterWithConfig(db *sql.DB, cfg *Config) *chi.Mux {
 		_, _ = w.Write([]byte("ok"))
 	})
 
-	r.Get("/debug/cookies", func(w http.ResponseWriter, r *http.Request) {
-		type c struct{ Name, Value string }
-		var list []c
-		for _, ck := range r.Cookies() {
-			list = append(list, c{ck.Name, ck.Value})
-		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(list)
-	})
+	// Inbound lead capture (token-authenticated, rate-limited per IP)
+	r.With(newRateLimiter(30, time.Minute, h.clientIP).Middleware).Post("/hooks/leads", h.CaptureLead)
+
+	// Diagnostics (admins, or anyone in local mode)
+	r.With(h.RequireDebugAccess).Get("/debug", h.DebugInfo)
 
 	// Protected API
 	r.Route("/api", func(pr chi.Router) {
-		if strings.ToLower(cfg.AppEnv) != "local" {
-			pr.Use(h.RequireAuth)
-		}
+		pr.Use(h.RequireAuth)
+		pr.Use(h.AuditLog(r))
 
 		// Preflights to /api/... always return 204
 		pr.Options("/*", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusNoContent)
 		})
 
-		// Clients
-		pr.Get("/clients", h.ListClients)
-		pr.Post("/clients", h.CreateClient)
+		all := []string{RoleAdmin, RoleSales, RoleBookkeeper}
+		crm := []string{RoleAdmin, RoleSales}
+		admin := []string{RoleAdmin}
 
-		// Sales processes
-		pr.Get("/sales", h.ListSalesProcesses)
-		pr.Post("/sales", h.CreateSalesProcess)
-		pr.Patch("/sales/{id}", h.UpdateSalesProcess)
-		pr.Post("/sales/start", h.StartSalesProcess)
+		// Cookie sessions only: no token scope covers these
+		pr.Group(func(g chi.Router) {
+			g.Use(h.RequireCookieSession)
 
-		// Contracts
-		pr.Get("/contracts", h.ListContracts)
-		pr.Post("/contracts", h.CreateContract)
-		pr.Patch("/contracts/{id}", h.UpdateContract)
+			// CSRF token
+			g.Get("/csrf", h.GetCSRFToken)
 
-		// Stages
-		pr.Get("/stages", h.ListStages)
-		pr.Post("/stages", h.CreateStage)
-		pr.Patch("/stages/{id}/stats", h.UpdateStageStats)
+			// Own sessions
+			g.Get("/me/sessions", h.ListMySessions)
+			g.Delete("/me/sessions/{id}", h.RevokeMySession)
 
-		// Stage participants
-		pr.Post("/stages/{id}/participants", h.AddStageParticipant)
-		pr.Patch("/stages/{id}/participants/{participant_id}", h.UpdateStageParticipant)
+			// Personal API tokens
+			g.Get("/me/tokens", h.ListAPITokens)
+			g.Post("/me/tokens", h.CreateAPIToken)
+			g.Delete("/me/tokens/{id}", h.RevokeAPIToken)
+		})
+
+		// area groups routes under one token scope area (tokenScopeAreas)
+		// and the roles that may read and write them
+		area := func(scope string, read, write []string, routes func(g chi.Router)) {
+			pr.Group(func(g chi.Router) {
+				g.Use(h.RequireScope(scope), h.RequireRole(read, write))
+				routes(g)
+			})
+		}
+
+		// CRM: sales and admins; bookkeepers have no access
+		area("clients", crm, crm, func(g chi.Router) {
+			g.Get("/clients", h.ListClients)
+			g.Post("/clients", h.CreateClient)
+		})
+		area("email", crm, crm, func(g chi.Router) {
+			g.Get("/clients/{id}/emails", h.ListClientEmails)
+		})
+		area("sales", crm, crm, func(g chi.Router) {
+			g.Get("/sales", h.ListSalesProcesses)
+			g.Post("/sales", h.CreateSalesProcess)
+			g.Patch("/sales/{id}", h.UpdateSalesProcess)
+			g.Post("/sales/start", h.StartSalesProcess)
+		})
+		area("stages", crm, crm, func(g chi.Router) {
+			g.Get("/stages", h.ListStages)
+			g.Post("/stages", h.CreateStage)
+			g.Get("/stages/metrics", h.ListStageMetrics)
+			g.Get("/stages/{id}/metrics", h.GetStageMetrics)
+			g.Get("/stages/{id}", h.GetStage)
+			g.Patch("/stages/{id}", h.UpdateStage)
+			g.Delete("/stages/{id}", h.DeleteStage)
+			g.Patch("/stages/{id}/stats", h.UpdateStageStats)
+
+			// Stage participants
+			g.Get("/stages/{id}/participants", h.ListStageParticipants)
+			g.Post("/stages/{id}/participants", h.AddStageParticipant)
+			g.Patch("/stages/{id}/participants/{participant_id}", h.UpdateStageParticipant)
+			g.Delete("/stages/{id}/participants/{participant_id}", h.DeleteStageParticipant)
+			g.Post("/stages/{id}/participants/{participant_id}/convert", h.ConvertStageParticipant)
+
+			// Assign client
+			g.Post("/stages/{id}/assign-client", h.AssignClientToStage)
+		})
+		area("attribution", crm, crm, func(g chi.Router) {
+			g.Get("/attribution", h.GetAttribution)
+			g.Get("/attribution/compare", h.CompareAttribution)
+		})
 
-		// Assign client
-		pr.Post("/stages/{id}/assign-client", h.AssignClientToStage)
+		// Finance: everyone reads, bookkeepers and admins write
+		finance := []string{RoleAdmin, RoleBookkeeper}
+		area("contracts", all, finance, func(g chi.Router) {
+			g.Get("/contracts", h.ListContracts)
+			g.Post("/contracts", h.CreateContract)
+			g.Patch("/contracts/{id}", h.UpdateContract)
+		})
+		area("ad-spend", all, finance, func(g chi.Router) {
+			g.Get("/ad-spend", h.ListAdSpend)
+			g.Post("/ad-spend", h.CreateAdSpend)
+			g.Post("/ad-spend/import", h.ImportAdSpend)
+			g.Delete("/ad-spend/{id}", h.DeleteAdSpend)
+		})
+		area("expenses", all, finance, func(g chi.Router) {
+			g.Get("/expenses", h.ListExpenses)
+			g.Post("/expenses", h.CreateExpense)
+			g.Get("/expenses/schedule", h.ListExpenseSchedule)
+			g.Patch("/expenses/{id}", h.UpdateExpense)
+			g.Delete("/expenses/{id}", h.DeleteExpense)
+		})
+		area("cashflow", all, finance, func(g chi.Router) {
+			g.Get("/cashflow/forecast", h.CashflowForecast)
+		})
+		area("revenue", all, finance, func(g chi.Router) {
+			g.Get("/revenue/recognition", h.RevenueRecognition)
+		})
+		area("bank-imports", all, finance, func(g chi.Router) {
+			g.Get("/bank-imports", h.ListBankImports)
+			g.Post("/bank-imports", h.ImportBankStatement)
+			g.Get("/bank-imports/{id}", h.GetBankImport)
+			g.Get("/bank-imports/{id}/lines/{line_id}/candidates", h.ListBankLineCandidates)
+			g.Patch("/bank-imports/{id}/lines/{line_id}", h.UpdateBankLine)
+			g.Post("/bank-imports/{id}/confirm", h.ConfirmBankMatches)
+		})
+		area("sepa", all, finance, func(g chi.Router) {
+			// Mandates
+			g.Get("/clients/{id}/sepa-mandate", h.GetSepaMandate)
+			g.Put("/clients/{id}/sepa-mandate", h.UpsertSepaMandate)
+			g.Delete("/clients/{id}/sepa-mandate", h.DeleteSepaMandate)
+
+			// Direct debit batches
+			g.Get("/sepa/batches", h.ListSepaBatches)
+			g.Post("/sepa/batches", h.CreateSepaBatch)
+			g.Get("/sepa/batches/{id}/xml", h.GetSepaBatchXML)
+		})
+		area("dunning", all, finance, func(g chi.Router) {
+			g.Post("/dunning/run", h.RunDunning)
+			g.Get("/dunning/notices", h.ListDunningNotices)
+			g.Get("/dunning/notices/{id}/document", h.GetDunningDocument)
+		})
 
-		// Cashflow
-		pr.Get("/cashflow/forecast", h.CashflowForecast)
+		// Administration: settings are readable by everyone, the rest is admin only
+		area("settings", all, admin, func(g chi.Router) {
+			g.Get("/settings", h.ListSettings)
+			g.Get("/settings/{key}", h.GetSetting)
+			g.Put("/settings/{key}", h.UpsertSetting)
+		})
+		area("email", admin, admin, func(g chi.Router) {
+			g.Get("/email/templates", h.ListEmailTemplates)
+			g.Put("/email/templates/{key}", h.UpsertEmailTemplate)
+			g.Get("/email/outbox", h.ListEmailOutbox)
+			g.Post("/email/outbox/{id}/retry", h.RetryEmail)
+		})
+		area("webhooks", admin, admin, func(g chi.Router) {
+			g.Get("/webhooks", h.ListWebhooks)
+			g.Post("/webhooks", h.CreateWebhook)
+			g.Patch("/webhooks/{id}", h.UpdateWebhook)
+			g.Delete("/webhooks/{id}", h.DeleteWebhook)
+			g.Get("/webhooks/{id}/deliveries", h.ListWebhookDeliveries)
+			g.Post("/webhooks/deliveries/{id}/replay", h.ReplayWebhookDelivery)
+		})
+		area("admin", admin, admin, func(g chi.Router) {
+			g.Get("/admin/users", h.ListUsers)
+			g.Post("/admin/users", h.CreateUser)
+			g.Patch("/admin/users/{id}", h.UpdateUser)
+			g.Post("/admin/users/{id}/disable", h.DisableUser)
+			g.Post("/admin/users/{id}/enable", h.EnableUser)
+			g.Post("/admin/users/{id}/logout", h.LogoutUser)
+			g.Delete("/admin/users/{id}/identities", h.ResetUserIdentities)
+		})
 
-		// Settings
-		pr.Get("/settings", h.ListSettings)
-		pr.Get("/settings/{key}", h.GetSetting)
-		pr.Put("/settings/{key}", h.UpsertSetting)
+		// Audit log: admins, no token area
+		pr.Group(func(g chi.Router) {
+			g.Use(h.RequireRole(admin, admin))
+			g.Get("/audit", h.ListAudit)
+		})
 	})
 
 	return r
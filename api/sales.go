@@ -3,6 +3,7 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -100,6 +101,17 @@ func (h *Handler) ListSalesProcesses(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(processes)
 }
 
+// Payload of the sales.stage_changed webhook event
+type SalesStageChangedEvent struct {
+	SalesProcessID int      `json:"sales_process_id"`
+	ClientID       int      `json:"client_id"`
+	ClientName     string   `json:"client_name"`
+	From           *string  `json:"from"`
+	To             string   `json:"to"`
+	Abschluss      *bool    `json:"abschluss,omitempty"`
+	Revenue        *float64 `json:"revenue,omitempty"`
+}
+
 // POST /api/sales
 func (h *Handler) CreateSalesProcess(w http.ResponseWriter, r *http.Request) {
 	var sp SalesProcess
@@ -177,6 +189,16 @@ func (h *Handler) UpdateSalesProcess(w http.ResponseWriter, r *http.Request) {
 		sp.ZweitgespraechResult = &t
 	}
 
+	// remember the stage to detect transitions for webhooks
+	var prevStage sql.NullString
+	if err := h.DB.QueryRow(`SELECT stage FROM sales_process WHERE id = $1`, id).Scan(&prevStage); err == sql.ErrNoRows {
+		http.Error(w, "sales process not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// ---------- UPDATE SALES_PROCESS (fields + normalized stage) ----------
 	_, err = h.DB.Exec(`
 		UPDATE sales_process
@@ -253,18 +275,32 @@ func (h *Handler) UpdateSalesProcess(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if !exists {
-			_, err = h.DB.Exec(`
+			c := Contract{
+				ClientID:       clientID,
+				SalesProcessID: id,
+				StartDate:      *sp.ContractStartDate,
+				DurationMonths: *sp.ContractDurationMonths,
+				RevenueTotal:   *sp.Revenue,
+				PaymentFreq:    *sp.ContractFrequency,
+			}
+			err = h.DB.QueryRow(`
 				INSERT INTO contracts
 					(client_id, sales_process_id, start_date, end_date, duration_months, revenue_total, payment_frequency)
 				VALUES ($1, $2, $3::date, NULL, $4, $5, $6)
-			`, clientID, id, *sp.ContractStartDate, *sp.ContractDurationMonths, *sp.Revenue, *sp.ContractFrequency)
+				RETURNING id
+			`, c.ClientID, c.SalesProcessID, c.StartDate, c.DurationMonths, c.RevenueTotal, c.PaymentFreq).Scan(&c.ID)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			h.emitEvent(EventContractCreated, c)
 		}
 	}
 
+	if sp.Abschluss != nil && *sp.Abschluss {
+		h.notifyDealWon(id, sp)
+	}
+
 	// ---------- RETURN UPDATED ROW ----------
 	row := h.DB.QueryRow(`
 	  SELECT
@@ -308,6 +344,21 @@ func (h *Handler) UpdateSalesProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if updated.Stage != prevStage.String {
+		ev := SalesStageChangedEvent{
+			SalesProcessID: updated.ID,
+			ClientID:       updated.ClientID,
+			ClientName:     updated.ClientName,
+			To:             updated.Stage,
+			Abschluss:      updated.Abschluss,
+			Revenue:        updated.Revenue,
+		}
+		if prevStage.Valid {
+			ev.From = &prevStage.String
+		}
+		h.emitEvent(EventSalesStageChanged, ev)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(updated)
 }
@@ -363,6 +414,30 @@ func (h *Handler) StartSalesProcess(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
+	resp, err := startSalesProcessTx(tx, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.emitSalesStarted(resp, true)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201 + body
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		// last-ditch error path: headers are already sent; just log
+		log.Printf("encode StartSalesProcessResponse failed: %v", err)
+	}
+}
+
+// startSalesProcessTx inserts the client and its sales process inside tx.
+// Also used by the inbound lead hook.
+func startSalesProcessTx(tx *sql.Tx, req StartSalesProcessRequest) (StartSalesProcessResponse, error) {
 	// 1) insert client
 	var clientID int
 	if err := tx.QueryRow(
@@ -371,8 +446,7 @@ func (h *Handler) StartSalesProcess(w http.ResponseWriter, r *http.Request) {
 		 RETURNING id`,
 		req.Name, req.Email, req.Phone, req.Source, req.SourceStageID,
 	).Scan(&clientID); err != nil {
-		http.Error(w, "insert client: "+err.Error(), http.StatusInternalServerError)
-		return
+		return StartSalesProcessResponse{}, fmt.Errorf("insert client: %w", err)
 	}
 
 	// 2) insert sales process
@@ -383,16 +457,10 @@ func (h *Handler) StartSalesProcess(w http.ResponseWriter, r *http.Request) {
 		 RETURNING id`,
 		clientID, req.ZweitgespraechDate, req.SourceStageID,
 	).Scan(&salesProcessID); err != nil {
-		http.Error(w, "insert sales_process: "+err.Error(), http.StatusInternalServerError)
-		return
+		return StartSalesProcessResponse{}, fmt.Errorf("insert sales_process: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		http.Error(w, "commit: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	resp := StartSalesProcessResponse{
+	return StartSalesProcessResponse{
 		SalesProcessID: salesProcessID,
 		Client: StartSalesProcessClient{
 			ID:            clientID,
@@ -412,12 +480,18 @@ func (h *Handler) StartSalesProcess(w http.ResponseWriter, r *http.Request) {
 			Revenue:              nil,
 			StageID:              req.SourceStageID,
 		},
-	}
+	}, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated) // 201 + body
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		// last-ditch error path: headers are already sent; just log
-		log.Printf("encode StartSalesProcessResponse failed: %v", err)
+// emitSalesStarted publishes the webhook events of a started sales process.
+func (h *Handler) emitSalesStarted(resp StartSalesProcessResponse, newClient bool) {
+	if newClient {
+		h.emitEvent(EventClientCreated, resp.Client)
 	}
+	h.emitEvent(EventSalesStageChanged, SalesStageChangedEvent{
+		SalesProcessID: resp.SalesProcessID,
+		ClientID:       resp.Client.ID,
+		ClientName:     resp.Client.Name,
+		To:             resp.SalesProcess.Stage,
+	})
 }
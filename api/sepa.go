@@ -0,0 +1,703 @@
+// api/sepa.go
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SepaMandate struct {
+	IBAN      string  `json:"iban"`
+	BIC       *string `json:"bic,omitempty"`
+	MandateID string  `json:"mandate_id"`
+	SignedAt  string  `json:"signed_at"` // YYYY-MM-DD
+}
+
+type SepaBatch struct {
+	ID                   int     `json:"id"`
+	MessageID            string  `json:"message_id"`
+	CollectionDate       string  `json:"collection_date"`
+	PeriodFrom           string  `json:"period_from"`
+	PeriodTo             string  `json:"period_to"`
+	NumberOfTransactions int     `json:"number_of_transactions"`
+	ControlSum           float64 `json:"control_sum"`
+	CreatedAt            string  `json:"created_at"`
+}
+
+type SepaBatchResponse struct {
+	SepaBatch
+	Skipped []SepaSkippedEntry `json:"skipped"`
+}
+
+// Due entries that could not be collected (no mandate, invalid IBAN, …).
+type SepaSkippedEntry struct {
+	CashflowEntryID int    `json:"cashflow_entry_id"`
+	ClientID        int    `json:"client_id"`
+	ClientName      string `json:"client_name"`
+	Reason          string `json:"reason"`
+}
+
+// GET /api/clients/{id}/sepa-mandate
+func (h *Handler) GetSepaMandate(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid client id", http.StatusBadRequest)
+		return
+	}
+
+	var iban, mandateID, signedAt sql.NullString
+	var m SepaMandate
+	err = h.DB.QueryRow(`
+		SELECT sepa_iban, sepa_bic, sepa_mandate_id, to_char(sepa_mandate_signed_at, 'YYYY-MM-DD')
+		FROM clients WHERE id = $1`, clientID,
+	).Scan(&iban, &m.BIC, &mandateID, &signedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "client not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !mandateID.Valid {
+		http.Error(w, "no mandate", http.StatusNotFound)
+		return
+	}
+	m.IBAN, m.MandateID, m.SignedAt = iban.String, mandateID.String, signedAt.String
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(m)
+}
+
+/*
+PUT /api/clients/{id}/sepa-mandate
+
+	{
+	  "iban": "DE89 3704 0044 0532 0130 00",
+	  "bic": "COBADEFFXXX",
+	  "mandate_id": "ANNA-2025-0042",
+	  "signed_at": "2025-09-20"
+	}
+*/
+func (h *Handler) UpsertSepaMandate(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid client id", http.StatusBadRequest)
+		return
+	}
+
+	var m SepaMandate
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.IBAN = normalizeIBAN(m.IBAN)
+	if err := validateIBAN(m.IBAN); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if m.BIC != nil {
+		bic := strings.ToUpper(strings.TrimSpace(*m.BIC))
+		if bic == "" {
+			m.BIC = nil
+		} else if !isValidBIC(bic) {
+			http.Error(w, "invalid BIC", http.StatusBadRequest)
+			return
+		} else {
+			m.BIC = &bic
+		}
+	}
+	m.MandateID = strings.TrimSpace(m.MandateID)
+	if m.MandateID == "" || len(m.MandateID) > 35 || sepaText(m.MandateID, 35) != m.MandateID {
+		http.Error(w, "mandate_id must be 1-35 SEPA characters", http.StatusBadRequest)
+		return
+	}
+	signed, err := time.Parse("2006-01-02", m.SignedAt)
+	if err != nil {
+		http.Error(w, "signed_at must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if signed.After(time.Now()) {
+		http.Error(w, "signed_at cannot be in the future", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.DB.Exec(`
+		UPDATE clients
+		SET sepa_iban = $1, sepa_bic = $2, sepa_mandate_id = $3, sepa_mandate_signed_at = $4::date
+		WHERE id = $5`,
+		m.IBAN, m.BIC, m.MandateID, m.SignedAt, clientID,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "client not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(m)
+}
+
+// DELETE /api/clients/{id}/sepa-mandate
+func (h *Handler) DeleteSepaMandate(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid client id", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.DB.Exec(`
+		UPDATE clients
+		SET sepa_iban = NULL, sepa_bic = NULL, sepa_mandate_id = NULL, sepa_mandate_signed_at = NULL
+		WHERE id = $1`, clientID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "client not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/sepa/batches
+func (h *Handler) ListSepaBatches(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(`
+		SELECT id, message_id,
+		       to_char(collection_date, 'YYYY-MM-DD'),
+		       to_char(period_from, 'YYYY-MM-DD'),
+		       to_char(period_to, 'YYYY-MM-DD'),
+		       number_of_transactions, control_sum,
+		       to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')
+		FROM sepa_batches
+		ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []SepaBatch{}
+	for rows.Next() {
+		var b SepaBatch
+		if err := rows.Scan(&b.ID, &b.MessageID, &b.CollectionDate, &b.PeriodFrom, &b.PeriodTo,
+			&b.NumberOfTransactions, &b.ControlSum, &b.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, b)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// GET /api/sepa/batches/{id}/xml  -> pain.008 file for upload to the bank
+func (h *Handler) GetSepaBatchXML(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid batch id", http.StatusBadRequest)
+		return
+	}
+
+	var msgID, doc string
+	err = h.DB.QueryRow(`SELECT message_id, xml FROM sepa_batches WHERE id = $1`, id).Scan(&msgID, &doc)
+	if err == sql.ErrNoRows {
+		http.Error(w, "batch not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xml"`, msgID))
+	_, _ = w.Write([]byte(doc))
+}
+
+/*
+	POST /api/sepa/batches
+
+Builds one pain.008.001.02 batch for all open cashflow_entries due in
+[from, to] whose client has a mandate, and marks them as submitted.
+
+	{
+	  "from": "2025-11-01",
+	  "to": "2025-11-30",
+	  "collection_date": "2025-11-05"   // optional, default: tomorrow
+	}
+
+Creditor data comes from app_settings (value_text):
+sepa_creditor_name, sepa_creditor_iban, sepa_creditor_bic (optional), sepa_creditor_id.
+*/
+func (h *Handler) CreateSepaBatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		From           string  `json:"from"`
+		To             string  `json:"to"`
+		CollectionDate *string `json:"collection_date,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err1 := time.Parse("2006-01-02", req.From)
+	to, err2 := time.Parse("2006-01-02", req.To)
+	if err1 != nil || err2 != nil || to.Before(from) {
+		http.Error(w, "from/to must be YYYY-MM-DD with from <= to", http.StatusBadRequest)
+		return
+	}
+	tomorrow, _ := time.Parse("2006-01-02", time.Now().AddDate(0, 0, 1).Format("2006-01-02"))
+	collection := tomorrow
+	if req.CollectionDate != nil {
+		c, err := time.Parse("2006-01-02", *req.CollectionDate)
+		if err != nil {
+			http.Error(w, "collection_date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		if c.Before(tomorrow) {
+			http.Error(w, "collection_date must be in the future", http.StatusBadRequest)
+			return
+		}
+		collection = c
+	}
+
+	creditor := sepaCreditor{
+		Name: sepaText(h.getTextSetting("sepa_creditor_name", ""), 70),
+		IBAN: normalizeIBAN(h.getTextSetting("sepa_creditor_iban", "")),
+		BIC:  strings.ToUpper(strings.TrimSpace(h.getTextSetting("sepa_creditor_bic", ""))),
+		ID:   strings.ToUpper(strings.TrimSpace(h.getTextSetting("sepa_creditor_id", ""))),
+	}
+	if creditor.Name == "" || creditor.ID == "" {
+		http.Error(w, "sepa_creditor_name and sepa_creditor_id settings are required", http.StatusBadRequest)
+		return
+	}
+	if err := validateIBAN(creditor.IBAN); err != nil {
+		http.Error(w, "sepa_creditor_iban: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if creditor.BIC != "" && !isValidBIC(creditor.BIC) {
+		http.Error(w, "sepa_creditor_bic: invalid BIC", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "begin tx: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT
+			cf.id,
+			cf.contract_id,
+			to_char(cf.due_date, 'YYYY-MM-DD'),
+			cf.amount,
+			cl.id,
+			cl.name,
+			cl.sepa_iban,
+			cl.sepa_bic,
+			cl.sepa_mandate_id,
+			to_char(cl.sepa_mandate_signed_at, 'YYYY-MM-DD'),
+			-- first collection under this mandate and debtor account?
+			-- a new mandate or a changed IBAN starts over with FRST
+			NOT EXISTS (
+				SELECT 1 FROM cashflow_entries x
+				WHERE x.sepa_batch_id IS NOT NULL
+				  AND x.sepa_mandate_id = cl.sepa_mandate_id
+				  AND x.sepa_iban = cl.sepa_iban
+			) AS first_collection
+		FROM cashflow_entries cf
+		JOIN contracts c ON c.id = cf.contract_id
+		JOIN clients cl  ON cl.id = c.client_id
+		WHERE cf.status IN ('pending','overdue')
+		  AND cf.amount > 0
+		  AND cf.due_date BETWEEN $1::date AND $2::date
+		ORDER BY cf.due_date, cf.id
+		FOR UPDATE OF cf`, req.From, req.To)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var txs []sepaDebit
+	skipped := []SepaSkippedEntry{}
+	firstSeen := map[string]bool{} // mandate id + IBAN
+	for rows.Next() {
+		var d sepaDebit
+		var amount string
+		var iban, bic, mandateID, signedAt sql.NullString
+		if err := rows.Scan(&d.EntryID, &d.ContractID, &d.DueDate, &amount, &d.ClientID, &d.DebtorName,
+			&iban, &bic, &mandateID, &signedAt, &d.First); err != nil {
+			rows.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		skip := SepaSkippedEntry{CashflowEntryID: d.EntryID, ClientID: d.ClientID, ClientName: d.DebtorName}
+		var exact bool
+		d.Cents, exact = sepaCents(amount)
+		switch {
+		case !exact:
+			skip.Reason = "amount has fractions of a cent"
+		case !mandateID.Valid || !iban.Valid || !signedAt.Valid:
+			skip.Reason = "no SEPA mandate"
+		case validateIBAN(iban.String) != nil:
+			skip.Reason = "invalid IBAN"
+		}
+		if skip.Reason != "" {
+			skipped = append(skipped, skip)
+			continue
+		}
+		d.IBAN, d.BIC, d.MandateID, d.SignedAt = iban.String, bic.String, mandateID.String, signedAt.String
+		// only the earliest due entry of a new mandate is the first collection
+		if d.First {
+			key := d.MandateID + "/" + d.IBAN
+			d.First = !firstSeen[key]
+			firstSeen[key] = true
+		}
+		txs = append(txs, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(txs) == 0 {
+		http.Error(w, "no due entries with a SEPA mandate in range", http.StatusBadRequest)
+		return
+	}
+
+	msgID := "DD-" + time.Now().UTC().Format("20060102150405") + "-" + randHex(4)
+	doc, err := buildPain008(msgID, time.Now(), creditor, collection, txs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b := SepaBatch{
+		MessageID:            msgID,
+		CollectionDate:       collection.Format("2006-01-02"),
+		PeriodFrom:           req.From,
+		PeriodTo:             req.To,
+		NumberOfTransactions: len(txs),
+		ControlSum:           float64(sepaControlSum(txs)) / 100,
+	}
+	if err := tx.QueryRow(`
+		INSERT INTO sepa_batches (message_id, collection_date, period_from, period_to, number_of_transactions, control_sum, xml)
+		VALUES ($1, $2::date, $3::date, $4::date, $5, $6, $7)
+		RETURNING id, to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')`,
+		b.MessageID, b.CollectionDate, b.PeriodFrom, b.PeriodTo, b.NumberOfTransactions, b.ControlSum, string(doc),
+	).Scan(&b.ID, &b.CreatedAt); err != nil {
+		http.Error(w, "insert batch: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, d := range txs {
+		if _, err := tx.Exec(`
+			UPDATE cashflow_entries
+			SET status = 'submitted', sepa_batch_id = $1, sepa_mandate_id = $2, sepa_iban = $3
+			WHERE id = $4`,
+			b.ID, d.MandateID, d.IBAN, d.EntryID,
+		); err != nil {
+			http.Error(w, "mark submitted: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(SepaBatchResponse{SepaBatch: b, Skipped: skipped})
+}
+
+/* ------------ pain.008.001.02 document ------------ */
+
+type sepaCreditor struct {
+	Name, IBAN, BIC, ID string
+}
+
+type sepaDebit struct {
+	EntryID    int
+	ClientID   int
+	ContractID int
+	DueDate    string
+	Cents      int64 // amount in euro cents, see sepaCents
+	DebtorName string
+	IBAN       string
+	BIC        string
+	MandateID  string
+	SignedAt   string
+	First      bool
+}
+
+type painDocument struct {
+	XMLName xml.Name       `xml:"Document"`
+	XMLNS   string         `xml:"xmlns,attr"`
+	Initn   painInitiation `xml:"CstmrDrctDbtInitn"`
+}
+
+type painInitiation struct {
+	GrpHdr  painGroupHeader `xml:"GrpHdr"`
+	PmtInfs []painPmtInf    `xml:"PmtInf"`
+}
+
+type painGroupHeader struct {
+	MsgID    string `xml:"MsgId"`
+	CreDtTm  string `xml:"CreDtTm"`
+	NbOfTxs  int    `xml:"NbOfTxs"`
+	CtrlSum  string `xml:"CtrlSum"`
+	InitgPty struct {
+		Nm string `xml:"Nm"`
+	} `xml:"InitgPty"`
+}
+
+// FinInstnId holds either the BIC or Othr/Id; an empty <Othr/> next to
+// the BIC does not validate.
+type painAgent struct {
+	BIC  string       `xml:"FinInstnId>BIC,omitempty"`
+	Othr *painOtherID `xml:"FinInstnId>Othr,omitempty"`
+}
+
+type painOtherID struct {
+	ID string `xml:"Id"`
+}
+
+func newPainAgent(bic string) painAgent {
+	if bic == "" {
+		return painAgent{Othr: &painOtherID{ID: "NOTPROVIDED"}}
+	}
+	return painAgent{BIC: bic}
+}
+
+type painPmtInf struct {
+	PmtInfID     string    `xml:"PmtInfId"`
+	PmtMtd       string    `xml:"PmtMtd"`
+	BtchBookg    bool      `xml:"BtchBookg"`
+	NbOfTxs      int       `xml:"NbOfTxs"`
+	CtrlSum      string    `xml:"CtrlSum"`
+	SvcLvl       string    `xml:"PmtTpInf>SvcLvl>Cd"`
+	LclInstrm    string    `xml:"PmtTpInf>LclInstrm>Cd"`
+	SeqTp        string    `xml:"PmtTpInf>SeqTp"`
+	ReqdColltnDt string    `xml:"ReqdColltnDt"`
+	CdtrNm       string    `xml:"Cdtr>Nm"`
+	CdtrIBAN     string    `xml:"CdtrAcct>Id>IBAN"`
+	CdtrAgt      painAgent `xml:"CdtrAgt"`
+	ChrgBr       string    `xml:"ChrgBr"`
+	CdtrSchmeID  struct {
+		ID      string `xml:"Id>PrvtId>Othr>Id"`
+		SchmeNm string `xml:"Id>PrvtId>Othr>SchmeNm>Prtry"`
+	} `xml:"CdtrSchmeId"`
+	Txs []painTx `xml:"DrctDbtTxInf"`
+}
+
+type painTx struct {
+	EndToEndID string `xml:"PmtId>EndToEndId"`
+	InstdAmt   struct {
+		Ccy   string `xml:"Ccy,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"InstdAmt"`
+	MndtID    string    `xml:"DrctDbtTx>MndtRltdInf>MndtId"`
+	DtOfSgntr string    `xml:"DrctDbtTx>MndtRltdInf>DtOfSgntr"`
+	DbtrAgt   painAgent `xml:"DbtrAgt"`
+	DbtrNm    string    `xml:"Dbtr>Nm"`
+	DbtrIBAN  string    `xml:"DbtrAcct>Id>IBAN"`
+	Ustrd     string    `xml:"RmtInf>Ustrd"`
+}
+
+// buildPain008 renders the batch, one PmtInf per sequence type (FRST/RCUR).
+func buildPain008(msgID string, created time.Time, cdtr sepaCreditor, collection time.Time, debits []sepaDebit) ([]byte, error) {
+	doc := painDocument{
+		XMLNS: "urn:iso:std:iso:20022:tech:xsd:pain.008.001.02",
+	}
+	hdr := &doc.Initn.GrpHdr
+	hdr.MsgID = msgID
+	hdr.CreDtTm = created.UTC().Format("2006-01-02T15:04:05")
+	hdr.NbOfTxs = len(debits)
+	hdr.CtrlSum = sepaAmount(sepaControlSum(debits))
+	hdr.InitgPty.Nm = cdtr.Name
+
+	for _, seq := range []string{"FRST", "RCUR"} {
+		var group []sepaDebit
+		for _, d := range debits {
+			if d.First == (seq == "FRST") {
+				group = append(group, d)
+			}
+		}
+		if len(group) == 0 {
+			continue
+		}
+
+		p := painPmtInf{
+			PmtInfID:     sepaText(msgID+"-"+seq, 35),
+			PmtMtd:       "DD",
+			BtchBookg:    true,
+			NbOfTxs:      len(group),
+			CtrlSum:      sepaAmount(sepaControlSum(group)),
+			SvcLvl:       "SEPA",
+			LclInstrm:    "CORE",
+			SeqTp:        seq,
+			ReqdColltnDt: collection.Format("2006-01-02"),
+			CdtrNm:       cdtr.Name,
+			CdtrIBAN:     cdtr.IBAN,
+			CdtrAgt:      newPainAgent(cdtr.BIC),
+			ChrgBr:       "SLEV",
+		}
+		p.CdtrSchmeID.ID = cdtr.ID
+		p.CdtrSchmeID.SchmeNm = "SEPA"
+
+		for _, d := range group {
+			t := painTx{
+				EndToEndID: fmt.Sprintf("CF%d", d.EntryID),
+				MndtID:     d.MandateID,
+				DtOfSgntr:  d.SignedAt,
+				DbtrAgt:    newPainAgent(d.BIC),
+				DbtrNm:     sepaText(d.DebtorName, 70),
+				DbtrIBAN:   d.IBAN,
+				Ustrd:      sepaText(fmt.Sprintf("Vertrag %d Rate %s", d.ContractID, d.DueDate), 140),
+			}
+			t.InstdAmt.Ccy = "EUR"
+			t.InstdAmt.Value = sepaAmount(d.Cents)
+			p.Txs = append(p.Txs, t)
+		}
+		doc.Initn.PmtInfs = append(doc.Initn.PmtInfs, p)
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+/* ------------ Validation & formatting ------------ */
+
+func normalizeIBAN(s string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(s), " ", ""))
+}
+
+// validateIBAN checks format and the ISO 13616 mod-97 checksum.
+func validateIBAN(iban string) error {
+	if len(iban) < 15 || len(iban) > 34 {
+		return errors.New("invalid IBAN length")
+	}
+	for i, c := range iban {
+		isLetter := c >= 'A' && c <= 'Z'
+		isDigit := c >= '0' && c <= '9'
+		if (i < 2 && !isLetter) || (i >= 2 && i < 4 && !isDigit) || (!isLetter && !isDigit) {
+			return errors.New("invalid IBAN format")
+		}
+	}
+	if iban[:2] == "DE" && len(iban) != 22 {
+		return errors.New("invalid IBAN length")
+	}
+
+	var digits strings.Builder
+	for _, c := range iban[4:] + iban[:4] {
+		if c >= 'A' && c <= 'Z' {
+			digits.WriteString(strconv.Itoa(int(c-'A') + 10))
+		} else {
+			digits.WriteRune(c)
+		}
+	}
+	n, _ := new(big.Int).SetString(digits.String(), 10)
+	if new(big.Int).Mod(n, big.NewInt(97)).Int64() != 1 {
+		return errors.New("invalid IBAN checksum")
+	}
+	return nil
+}
+
+// isValidBIC: 4 letters bank, 2 letters country, 2 alnum location, optional 3 alnum branch.
+func isValidBIC(bic string) bool {
+	if len(bic) != 8 && len(bic) != 11 {
+		return false
+	}
+	for i, c := range bic {
+		isLetter := c >= 'A' && c <= 'Z'
+		isDigit := c >= '0' && c <= '9'
+		if (i < 6 && !isLetter) || (!isLetter && !isDigit) {
+			return false
+		}
+	}
+	return true
+}
+
+var sepaUmlauts = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue", "ß", "ss", "&", "+")
+
+// sepaText reduces s to the SEPA (EPC) Latin character set and max length.
+func sepaText(s string, max int) string {
+	s = sepaUmlauts.Replace(strings.TrimSpace(s))
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			strings.ContainsRune("/-?:().,'+ ", c):
+			b.WriteRune(c)
+		default:
+			b.WriteRune('.')
+		}
+	}
+	out := b.String()
+	if len(out) > max {
+		out = out[:max]
+	}
+	return out
+}
+
+func sepaAmount(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+// sepaCents reads a NUMERIC amount exactly. InstdAmt has two decimals,
+// so fractions of a cent are refused (ok false) rather than rounded: the
+// entry is skipped and has to be corrected.
+func sepaCents(numeric string) (cents int64, ok bool) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(numeric), ".")
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > 2 || whole == "" || !isDigits(whole) || (frac != "" && !isDigits(frac)) {
+		return 0, false
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	f, _ := strconv.ParseInt(frac, 10, 64)
+	return w*100 + f, true
+}
+
+// sepaControlSum adds the debits' cents, the same values InstdAmt shows.
+func sepaControlSum(debits []sepaDebit) int64 {
+	var cents int64
+	for _, d := range debits {
+		cents += d.Cents
+	}
+	return cents
+}
+
+func randHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata golden files")
+
+func testSepaDebits() (sepaCreditor, []sepaDebit) {
+	cdtr := sepaCreditor{
+		Name: "Anna Lanah Coaching",
+		IBAN: "DE89370400440532013000",
+		BIC:  "COBADEFFXXX",
+		ID:   "DE98ZZZ09999999999",
+	}
+	debits := []sepaDebit{
+		{EntryID: 101, ClientID: 1, ContractID: 7, DueDate: "2025-11-01", Cents: 45000,
+			DebtorName: "Max Müller & Söhne", IBAN: "DE02120300000000202051", BIC: "BYLADEM1001",
+			MandateID: "ANNA-2025-0042", SignedAt: "2025-09-20", First: true},
+		{EntryID: 102, ClientID: 2, ContractID: 8, DueDate: "2025-11-03", Cents: 19999,
+			DebtorName: "Erika Mustermann", IBAN: "DE02500105170137075030",
+			MandateID: "ANNA-2025-0017", SignedAt: "2025-03-02"},
+		{EntryID: 103, ClientID: 3, ContractID: 9, DueDate: "2025-11-15", Cents: 10,
+			DebtorName: "Jürgen Weiß", IBAN: "DE02100100100006820101",
+			MandateID: "ANNA-2025-0031", SignedAt: "2025-06-11"},
+	}
+	return cdtr, debits
+}
+
+func TestBuildPain008Golden(t *testing.T) {
+	cdtr, debits := testSepaDebits()
+	created := time.Date(2025, 10, 28, 9, 30, 0, 0, time.UTC)
+	collection := time.Date(2025, 11, 5, 0, 0, 0, 0, time.UTC)
+
+	got, err := buildPain008("DD-20251028093000-abcd", created, cdtr, collection, debits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "pain.008.001.02.golden.xml")
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("pain.008 differs from %s (run with -update after checking the change)\n%s", golden, got)
+	}
+}
+
+// xmllintSchema validates doc against the vendored pain.008.001.02 XSD.
+func xmllintSchema(t *testing.T, doc []byte) error {
+	t.Helper()
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint not installed")
+	}
+	file := filepath.Join(t.TempDir(), "pain.008.xml")
+	if err := os.WriteFile(file, doc, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(xmllint, "--noout", "--schema",
+		filepath.Join("testdata", "pain.008.001.02.xsd"), file).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
+
+func TestBuildPain008Schema(t *testing.T) {
+	cdtr, debits := testSepaDebits()
+	doc, err := buildPain008("DD-20251028093000-abcd", time.Now(), cdtr, time.Now().AddDate(0, 0, 1), debits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xmllintSchema(t, doc); err != nil {
+		t.Fatalf("pain.008 does not validate:\n%v", err)
+	}
+
+	// the schema must catch what we could get wrong: order, required
+	// elements, empty agents
+	broken := map[string]string{
+		"missing ReqdColltnDt": regexp.MustCompile(`<ReqdColltnDt>[^<]*</ReqdColltnDt>`).ReplaceAllString(string(doc), ""),
+		"empty Othr":           strings.Replace(string(doc), "<BIC>COBADEFFXXX</BIC>", "<BIC>COBADEFFXXX</BIC><Othr></Othr>", 1),
+		"element order": strings.Replace(string(doc),
+			"<PmtMtd>DD</PmtMtd>\n      <BtchBookg>true</BtchBookg>",
+			"<BtchBookg>true</BtchBookg>\n      <PmtMtd>DD</PmtMtd>", 1),
+	}
+	for name, b := range broken {
+		if b == string(doc) {
+			t.Fatalf("%s: replacement did not apply", name)
+		}
+		if xmllintSchema(t, []byte(b)) == nil {
+			t.Errorf("%s: schema accepted a broken document", name)
+		}
+	}
+}
+
+// EPC basic Latin character set allowed in SEPA text fields.
+var sepaCharset = regexp.MustCompile(`^[A-Za-z0-9/\-?:().,'+ ]*$`)
+
+// TestBuildPain008Rules checks what the XSD doesn't: the EPC character
+// set and that counts and control sums add up.
+func TestBuildPain008Rules(t *testing.T) {
+	cdtr, debits := testSepaDebits()
+	doc, err := buildPain008("DD-20251028093000-abcd", time.Now(), cdtr, time.Now().AddDate(0, 0, 1), debits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(doc, []byte(xml.Header)) {
+		t.Error("missing XML declaration")
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	var name string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			name = el.Name.Local
+		case xml.CharData:
+			v := strings.TrimSpace(string(el))
+			if (name == "Nm" || name == "Ustrd" || name == "EndToEndId" || name == "MndtId") && !sepaCharset.MatchString(v) {
+				t.Errorf("%s = %q has characters outside the SEPA set", name, v)
+			}
+		}
+	}
+
+	var parsed painDocument
+	if err := xml.Unmarshal(doc, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	hdr := parsed.Initn.GrpHdr
+	if hdr.NbOfTxs != len(debits) {
+		t.Errorf("GrpHdr/NbOfTxs = %d, want %d", hdr.NbOfTxs, len(debits))
+	}
+	if want := sepaAmount(sepaControlSum(debits)); hdr.CtrlSum != want {
+		t.Errorf("GrpHdr/CtrlSum = %s, want %s", hdr.CtrlSum, want)
+	}
+
+	seqs := map[string]int{}
+	n := 0
+	for _, p := range parsed.Initn.PmtInfs {
+		seqs[p.SeqTp] = len(p.Txs)
+		n += len(p.Txs)
+		if p.NbOfTxs != len(p.Txs) {
+			t.Errorf("PmtInf %s NbOfTxs = %d, has %d", p.PmtInfID, p.NbOfTxs, len(p.Txs))
+		}
+		var cents int64
+		for _, tx := range p.Txs {
+			c, ok := sepaCents(tx.InstdAmt.Value)
+			if !ok {
+				t.Errorf("InstdAmt %q is not a cent amount", tx.InstdAmt.Value)
+			}
+			cents += c
+			if tx.InstdAmt.Ccy != "EUR" {
+				t.Errorf("InstdAmt Ccy = %q", tx.InstdAmt.Ccy)
+			}
+		}
+		if got := sepaAmount(cents); got != p.CtrlSum {
+			t.Errorf("PmtInf %s CtrlSum = %s, transactions sum to %s", p.PmtInfID, p.CtrlSum, got)
+		}
+	}
+	if n != len(debits) || seqs["FRST"] != 1 || seqs["RCUR"] != 2 {
+		t.Errorf("sequence types %v, want FRST:1 RCUR:2", seqs)
+	}
+}
+
+func TestSepaCents(t *testing.T) {
+	tests := []struct {
+		in    string
+		cents int64
+		ok    bool
+	}{
+		{"450", 45000, true},
+		{"199.99", 19999, true},
+		{"0.1", 10, true},
+		{"100.120", 10012, true},
+		{"100.125", 0, false},
+		{"0.001", 0, false},
+		{"-5.00", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		cents, ok := sepaCents(tt.in)
+		if cents != tt.cents || ok != tt.ok {
+			t.Errorf("sepaCents(%q) = %d, %v, want %d, %v", tt.in, cents, ok, tt.cents, tt.ok)
+		}
+	}
+	if got := sepaAmount(10012); got != "100.12" {
+		t.Errorf("sepaAmount(10012) = %s", got)
+	}
+}
@@ -0,0 +1,220 @@
+// api/sessions.go
+package api
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SessionInfo struct {
+	ID         string  `json:"id"`
+	IP         *string `json:"ip,omitempty"`
+	UserAgent  *string `json:"user_agent,omitempty"`
+	CreatedAt  string  `json:"created_at"`
+	LastSeenAt string  `json:"last_seen_at"`
+	ExpiresAt  string  `json:"expires_at"`
+	Current    bool    `json:"current"`
+}
+
+// last_seen_at is written at most this often; the cookie is re-issued
+// (sliding expiry) at the same time.
+const sessionTouchInterval = time.Minute
+
+// startSession stores a new session for the user and sets its cookie.
+func (h *Handler) startSession(w http.ResponseWriter, r *http.Request, userID int) error {
+	id := randHex(32)
+	now := time.Now()
+	maxExp := now.Add(h.Cfg.SessionMaxAge)
+	if _, err := h.DB.Exec(`
+		INSERT INTO sessions (id, user_id, ip, user_agent, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)`,
+		id, userID, h.clientIP(r), r.UserAgent(), maxExp,
+	); err != nil {
+		return err
+	}
+	http.SetCookie(w, h.Auth.makeCookie(id, h.cookieExpiry(now, maxExp), isSecure(r)))
+	return nil
+}
+
+// cookieExpiry is the idle deadline, capped by the absolute expiry.
+func (h *Handler) cookieExpiry(lastSeen, expiresAt time.Time) time.Time {
+	exp := lastSeen.Add(h.Cfg.SessionIdleTimeout)
+	if expiresAt.Before(exp) {
+		return expiresAt
+	}
+	return exp
+}
+
+// sessionID returns the id from a session cookie signed with any of the
+// accepted keys.
+func (a *Auth) sessionID(r *http.Request) (string, bool) {
+	c, err := r.Cookie(a.CookieName)
+	if err != nil {
+		return "", false
+	}
+	id, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	for _, key := range a.CookieKeys {
+		if hmac.Equal([]byte(hmacSign(key, []byte(id))), []byte(sig)) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// parseSession loads the live session behind the request cookie. Revoked,
+// idle and expired sessions and disabled users don't count.
+func (h *Handler) parseSession(r *http.Request) (*Session, bool) {
+	if h == nil || h.Auth == nil || h.Auth.CookieName == "" {
+		return nil, false
+	}
+	id, ok := h.Auth.sessionID(r)
+	if !ok {
+		return nil, false
+	}
+	var s Session
+	var lastSeen, expiresAt time.Time
+	err := h.DB.QueryRow(`
+		SELECT s.id, u.email, COALESCE(u.name, ''), u.role, s.last_seen_at, s.expires_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = $1
+		  AND s.revoked_at IS NULL
+		  AND s.expires_at > now()
+		  AND s.last_seen_at > now() - $2 * interval '1 second'
+		  AND u.status <> 'disabled'`,
+		id, h.Cfg.SessionIdleTimeout.Seconds(),
+	).Scan(&s.ID, &s.Email, &s.Name, &s.Role, &lastSeen, &expiresAt)
+	if err != nil {
+		return nil, false
+	}
+	s.Exp = h.cookieExpiry(lastSeen, expiresAt)
+	s.lastSeen = lastSeen
+	s.expiresAt = expiresAt
+	return &s, true
+}
+
+// touchSession records activity and slides the cookie expiry forward.
+func (h *Handler) touchSession(w http.ResponseWriter, r *http.Request, s *Session) {
+	now := time.Now()
+	if now.Sub(s.lastSeen) < sessionTouchInterval {
+		return
+	}
+	if _, err := h.DB.Exec(`
+		UPDATE sessions SET last_seen_at = now(), ip = $2
+		WHERE id = $1`, s.ID, h.clientIP(r),
+	); err != nil {
+		return
+	}
+	s.Exp = h.cookieExpiry(now, s.expiresAt)
+	http.SetCookie(w, h.Auth.makeCookie(s.ID, s.Exp, isSecure(r)))
+}
+
+// revokeUserSessions ends all sessions of a user.
+func (h *Handler) revokeUserSessions(userID int) error {
+	_, err := h.DB.Exec(`
+		UPDATE sessions SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	return err
+}
+
+// GET /api/me/sessions
+func (h *Handler) ListMySessions(w http.ResponseWriter, r *http.Request) {
+	sess := currentSession(r)
+	if sess == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT s.id, s.ip, s.user_agent,
+		       to_char(s.created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ'),
+		       to_char(s.last_seen_at, 'YYYY-MM-DD"T"HH24:MI:SSZ'),
+		       to_char(s.expires_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE lower(u.email) = lower($1)
+		  AND s.revoked_at IS NULL
+		  AND s.expires_at > now()
+		  AND s.last_seen_at > now() - $2 * interval '1 second'
+		ORDER BY s.last_seen_at DESC`,
+		sess.Email, h.Cfg.SessionIdleTimeout.Seconds())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []SessionInfo{}
+	for rows.Next() {
+		var si SessionInfo
+		if err := rows.Scan(&si.ID, &si.IP, &si.UserAgent, &si.CreatedAt, &si.LastSeenAt, &si.ExpiresAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		si.Current = si.ID == sess.ID
+		out = append(out, si)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// DELETE /api/me/sessions/{id}
+// Only the caller's own sessions; revoking the current one logs out.
+func (h *Handler) RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	sess := currentSession(r)
+	if sess == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	res, err := h.DB.Exec(`
+		UPDATE sessions s SET revoked_at = now()
+		FROM users u
+		WHERE u.id = s.user_id
+		  AND s.id = $1
+		  AND lower(u.email) = lower($2)
+		  AND s.revoked_at IS NULL`, chi.URLParam(r, "id"), sess.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/admin/users/{id}/logout
+// Force-logout: ends every session of the user, who may sign in again.
+func (h *Handler) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+	var exists bool
+	if err := h.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, id).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err := h.revokeUserSessions(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
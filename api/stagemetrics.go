@@ -0,0 +1,187 @@
+// api/stagemetrics.go
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// StageFunnel counts every step of the funnel for one stage. A sales
+// process belongs to sales_process.stage_id, or to clients.source_stage_id
+// when the process has no stage of its own.
+type StageFunnel struct {
+	Registrations        int     `json:"registrations"`
+	Attendees            int     `json:"attendees"`
+	ZweitgespraechBooked int     `json:"zweitgespraech_booked"`
+	ZweitgespraechHeld   int     `json:"zweitgespraech_held"`
+	Abschluss            int     `json:"abschluss"`
+	ContractedRevenue    float64 `json:"contracted_revenue"`
+}
+
+type StageMetrics struct {
+	StageID int      `json:"stage_id"`
+	Name    string   `json:"name"`
+	Date    *string  `json:"date,omitempty"`
+	Budget  *float64 `json:"budget,omitempty"` // stages.ad_budget
+	Spend   float64  `json:"spend"`            // ad_spend_entries
+	// Cost is the actual spend once the ledger has entries for the stage,
+	// the budget before that; CostSource says which ("spend" | "budget").
+	Cost           float64            `json:"cost"`
+	CostSource     string             `json:"cost_source"`
+	SpendByChannel map[string]float64 `json:"spend_by_channel"`
+
+	Funnel StageFunnel `json:"funnel"`
+
+	// nil when the denominator is zero
+	CostPerRegistration *float64 `json:"cost_per_registration"`
+	CostPerAttendee     *float64 `json:"cost_per_attendee"`
+	CostPerAcquisition  *float64 `json:"cost_per_acquisition"`
+	ROAS                *float64 `json:"roas"`
+}
+
+const stageMetricsQuery = `
+	WITH sp_attr AS (
+		SELECT sp.id,
+		       COALESCE(sp.stage_id, cl.source_stage_id) AS stage_id,
+		       sp.zweitgespraech_date,
+		       sp.zweitgespraech_result,
+		       sp.abschluss
+		FROM sales_process sp
+		JOIN clients cl ON cl.id = sp.client_id
+	),
+	funnel AS (
+		SELECT stage_id,
+		       COUNT(*) FILTER (WHERE zweitgespraech_date IS NOT NULL) AS booked,
+		       COUNT(*) FILTER (WHERE zweitgespraech_result)           AS held,
+		       COUNT(*) FILTER (WHERE abschluss)                       AS won
+		FROM sp_attr
+		WHERE stage_id IS NOT NULL
+		GROUP BY stage_id
+	),
+	spend AS (
+		SELECT stage_id, SUM(amount) AS total, json_object_agg(channel, amount) AS by_channel
+		FROM (
+			SELECT stage_id, channel, SUM(amount) AS amount
+			FROM ad_spend_entries
+			WHERE stage_id IS NOT NULL
+			GROUP BY stage_id, channel
+		) x
+		GROUP BY stage_id
+	),
+	revenue AS (
+		SELECT a.stage_id, SUM(c.revenue_total) AS revenue
+		FROM contracts c
+		JOIN sp_attr a ON a.id = c.sales_process_id
+		WHERE a.stage_id IS NOT NULL
+		GROUP BY a.stage_id
+	)
+	SELECT` + stageColumns + `,
+		COALESCE(f.booked, 0),
+		COALESCE(f.held, 0),
+		COALESCE(f.won, 0),
+		COALESCE(rv.revenue, 0),
+		sd.total,
+		sd.by_channel` + stageFrom + `
+	LEFT JOIN funnel f   ON f.stage_id = s.id
+	LEFT JOIN spend sd   ON sd.stage_id = s.id
+	LEFT JOIN revenue rv ON rv.stage_id = s.id`
+
+func scanStageMetrics(sc interface{ Scan(...any) error }) (StageMetrics, error) {
+	var m StageMetrics
+	var spend *float64
+	var byChannel []byte
+	s, err := scanStage(sc, &m.Funnel.ZweitgespraechBooked, &m.Funnel.ZweitgespraechHeld,
+		&m.Funnel.Abschluss, &m.Funnel.ContractedRevenue, &spend, &byChannel)
+	if err != nil {
+		return m, err
+	}
+	m.StageID, m.Name, m.Date, m.Budget = s.ID, s.Name, s.Date, s.AdBudget
+	m.SpendByChannel = map[string]float64{}
+	if byChannel != nil {
+		if err := json.Unmarshal(byChannel, &m.SpendByChannel); err != nil {
+			return m, err
+		}
+	}
+	switch {
+	case spend != nil:
+		m.Spend, m.Cost, m.CostSource = *spend, *spend, "spend"
+	case s.AdBudget != nil:
+		m.Cost, m.CostSource = *s.AdBudget, "budget"
+	default:
+		m.CostSource = "budget"
+	}
+	m.Funnel.Registrations = derefInt(s.Registrations)
+	m.Funnel.Attendees = derefInt(s.Participants)
+
+	m.CostPerRegistration = ratio(m.Cost, float64(m.Funnel.Registrations))
+	m.CostPerAttendee = ratio(m.Cost, float64(m.Funnel.Attendees))
+	m.CostPerAcquisition = ratio(m.Cost, float64(m.Funnel.Abschluss))
+	m.ROAS = ratio(m.Funnel.ContractedRevenue, m.Cost)
+	return m, nil
+}
+
+func ratio(a, b float64) *float64 {
+	if b == 0 {
+		return nil
+	}
+	v := a / b
+	return &v
+}
+
+// GET /api/stages/{id}/metrics
+func (h *Handler) GetStageMetrics(w http.ResponseWriter, r *http.Request) {
+	stageID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid stage id", http.StatusBadRequest)
+		return
+	}
+
+	m, err := scanStageMetrics(h.DB.QueryRow(stageMetricsQuery+` WHERE s.id = $1`, stageID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "stage not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(m)
+}
+
+// GET /api/stages/metrics?from=YYYY-MM-DD&to=YYYY-MM-DD
+func (h *Handler) ListStageMetrics(w http.ResponseWriter, r *http.Request) {
+	from, to, err := dateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query(stageMetricsQuery+`
+		WHERE ($1 = '' OR s.date >= NULLIF($1, '')::date)
+		  AND ($2 = '' OR s.date <= NULLIF($2, '')::date)
+		ORDER BY s.date DESC NULLS LAST, s.id DESC`, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []StageMetrics{}
+	for rows.Next() {
+		m, err := scanStageMetrics(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, m)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -1,37 +1,99 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/mail"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// Registrations/Participants are the effective numbers: counted from
+// stage_participants, or the manual values when StatsOverride is set.
+// Both sources are always returned; StatsMismatch flags disagreement.
 type Stage struct {
-	ID            int      `json:"id"`
-	Name          string   `json:"name"`
-	Date          *string  `json:"date,omitempty"`
-	AdBudget      *float64 `json:"ad_budget,omitempty"`
-	Registrations *int     `json:"registrations,omitempty"`
-	Participants  *int     `json:"participants,omitempty"`
+	ID                   int      `json:"id"`
+	Name                 string   `json:"name"`
+	Slug                 *string  `json:"slug,omitempty"`
+	Date                 *string  `json:"date,omitempty"`
+	AdBudget             *float64 `json:"ad_budget,omitempty"`
+	Registrations        *int     `json:"registrations,omitempty"`
+	Participants         *int     `json:"participants,omitempty"`
+	StatsOverride        bool     `json:"stats_override"`
+	ManualRegistrations  *int     `json:"manual_registrations,omitempty"`
+	ManualParticipants   *int     `json:"manual_participants,omitempty"`
+	CountedRegistrations int      `json:"counted_registrations"`
+	CountedParticipants  int      `json:"counted_participants"`
+	StatsMismatch        bool     `json:"stats_mismatch"`
 }
 
-// GET /api/stages
+const (
+	stageColumns = `
+		s.id, s.name, s.slug, s.date, s.ad_budget,
+		s.stats_override, s.registrations, s.participants,
+		COALESCE(pc.registrations, 0), COALESCE(pc.attended, 0)`
+	stageFrom = `
+	FROM stages s
+	LEFT JOIN LATERAL (
+		SELECT COUNT(*) AS registrations,
+		       COUNT(*) FILTER (WHERE p.attended) AS attended
+		FROM stage_participants p
+		WHERE p.stage_id = s.id
+	) pc ON true`
+	stageSelect = `SELECT` + stageColumns + stageFrom
+)
+
+// scanStage scans stageColumns followed by extra destinations.
+func scanStage(sc interface{ Scan(...any) error }, extra ...any) (Stage, error) {
+	var s Stage
+	dest := []any{&s.ID, &s.Name, &s.Slug, &s.Date, &s.AdBudget,
+		&s.StatsOverride, &s.ManualRegistrations, &s.ManualParticipants,
+		&s.CountedRegistrations, &s.CountedParticipants}
+	if err := sc.Scan(append(dest, extra...)...); err != nil {
+		return s, err
+	}
+	s.Registrations, s.Participants = &s.CountedRegistrations, &s.CountedParticipants
+	if s.StatsOverride {
+		s.Registrations, s.Participants = s.ManualRegistrations, s.ManualParticipants
+	}
+	s.StatsMismatch = (s.ManualRegistrations != nil && *s.ManualRegistrations != s.CountedRegistrations) ||
+		(s.ManualParticipants != nil && *s.ManualParticipants != s.CountedParticipants)
+	return s, nil
+}
+
+func (h *Handler) loadStage(stageID int) (Stage, error) {
+	return scanStage(h.DB.QueryRow(stageSelect+` WHERE s.id = $1`, stageID))
+}
+
+// GET /api/stages?from=YYYY-MM-DD&to=YYYY-MM-DD
+// Newest first; stages without a date come last.
 func (h *Handler) ListStages(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.DB.Query(`
-		SELECT id, name, date, ad_budget, registrations, participants
-		FROM stages`)
+	from, to, err := dateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query(stageSelect+`
+		WHERE ($1 = '' OR s.date >= NULLIF($1, '')::date)
+		  AND ($2 = '' OR s.date <= NULLIF($2, '')::date)
+		ORDER BY s.date DESC NULLS LAST, s.id DESC`, from, to)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 
-	var stages []Stage
+	stages := []Stage{}
 	for rows.Next() {
-		var s Stage
-		if err := rows.Scan(&s.ID, &s.Name, &s.Date, &s.AdBudget, &s.Registrations, &s.Participants); err != nil {
+		s, err := scanStage(rows)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -42,19 +104,380 @@ func (h *Handler) ListStages(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stages)
 }
 
+// dateRangeParams reads the optional ?from=&to= (YYYY-MM-DD) filter.
+func dateRangeParams(r *http.Request) (from, to string, err error) {
+	q := r.URL.Query()
+	from, to = q.Get("from"), q.Get("to")
+	for _, d := range []string{from, to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return "", "", fmt.Errorf("from/to must be YYYY-MM-DD")
+		}
+	}
+	return from, to, nil
+}
+
+type StageParticipant struct {
+	ID               int     `json:"id"`
+	StageID          int     `json:"stage_id"`
+	LinkedClientID   *int    `json:"linked_client_id,omitempty"`
+	LinkedClientName *string `json:"linked_client_name,omitempty"`
+	LeadName         *string `json:"lead_name,omitempty"`
+	LeadEmail        *string `json:"lead_email,omitempty"`
+	LeadPhone        *string `json:"lead_phone,omitempty"`
+	Attended         *bool   `json:"attended"`
+	CreatedAt        *string `json:"created_at,omitempty"`
+}
+
+type StageAssignedClient struct {
+	ClientID   int     `json:"client_id"`
+	Name       string  `json:"name"`
+	Email      *string `json:"email,omitempty"`
+	Status     *string `json:"status,omitempty"`
+	AssignedAt *string `json:"assigned_at,omitempty"`
+}
+
+type StageSalesProcess struct {
+	ID                   int      `json:"id"`
+	ClientID             int      `json:"client_id"`
+	ClientName           string   `json:"client_name"`
+	Stage                string   `json:"stage"`
+	ZweitgespraechDate   *string  `json:"zweitgespraech_date"`
+	ZweitgespraechResult *bool    `json:"zweitgespraech_result"`
+	Abschluss            *bool    `json:"abschluss"`
+	Revenue              *float64 `json:"revenue"`
+	ViaStageID           bool     `json:"via_stage_id"`        // sales_process.stage_id
+	ViaSourceStageID     bool     `json:"via_source_stage_id"` // clients.source_stage_id
+}
+
+type StageDetail struct {
+	Stage
+	ParticipantList []StageParticipant    `json:"participant_list"` // "participants" is the counter
+	AssignedClients []StageAssignedClient `json:"assigned_clients"`
+	SalesProcesses  []StageSalesProcess   `json:"sales_processes"`
+}
+
+// GET /api/stages/{id}
+func (h *Handler) GetStage(w http.ResponseWriter, r *http.Request) {
+	stageID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid stage id", http.StatusBadRequest)
+		return
+	}
+
+	var d StageDetail
+	d.Stage, err = h.loadStage(stageID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "stage not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if d.ParticipantList, err = h.loadStageParticipants(stageID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// assigned clients
+	d.AssignedClients = []StageAssignedClient{}
+	rows, err := h.DB.Query(`
+		SELECT c.id, c.name, c.email, c.status,
+		       to_char(MIN(a.assigned_at), 'YYYY-MM-DD"T"HH24:MI:SSZ')
+		FROM stage_client_assignments a
+		JOIN clients c ON c.id = a.client_id
+		WHERE a.stage_id = $1
+		GROUP BY c.id, c.name, c.email, c.status
+		ORDER BY MIN(a.assigned_at), c.id`, stageID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var c StageAssignedClient
+		if err := rows.Scan(&c.ClientID, &c.Name, &c.Email, &c.Status, &c.AssignedAt); err != nil {
+			rows.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		d.AssignedClients = append(d.AssignedClients, c)
+	}
+	rows.Close()
+
+	// sales processes attributed to the stage
+	d.SalesProcesses = []StageSalesProcess{}
+	rows, err = h.DB.Query(`
+		SELECT
+			sp.id,
+			sp.client_id,
+			cl.name,
+			sp.stage,
+			sp.zweitgespraech_date,
+			sp.zweitgespraech_result,
+			sp.abschluss,
+			CASE WHEN COALESCE(sp.abschluss, false) THEN sp.revenue ELSE NULL END,
+			COALESCE(sp.stage_id = $1, false),
+			COALESCE(cl.source_stage_id = $1, false)
+		FROM sales_process sp
+		JOIN clients cl ON cl.id = sp.client_id
+		WHERE sp.stage_id = $1 OR cl.source_stage_id = $1
+		ORDER BY sp.created_at DESC, sp.id DESC`, stageID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sp StageSalesProcess
+		if err := rows.Scan(&sp.ID, &sp.ClientID, &sp.ClientName, &sp.Stage, &sp.ZweitgespraechDate,
+			&sp.ZweitgespraechResult, &sp.Abschluss, &sp.Revenue, &sp.ViaStageID, &sp.ViaSourceStageID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		d.SalesProcesses = append(d.SalesProcesses, sp)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(d)
+}
+
+const stageParticipantSelect = `
+	SELECT p.id, p.stage_id, p.linked_client_id, c.name,
+	       p.lead_name, p.lead_email, p.lead_phone, p.attended,
+	       to_char(p.created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')
+	FROM stage_participants p
+	LEFT JOIN clients c ON c.id = p.linked_client_id`
+
+func scanStageParticipant(sc interface{ Scan(...any) error }) (StageParticipant, error) {
+	var p StageParticipant
+	err := sc.Scan(&p.ID, &p.StageID, &p.LinkedClientID, &p.LinkedClientName,
+		&p.LeadName, &p.LeadEmail, &p.LeadPhone, &p.Attended, &p.CreatedAt)
+	return p, err
+}
+
+func (h *Handler) loadStageParticipants(stageID int) ([]StageParticipant, error) {
+	rows, err := h.DB.Query(stageParticipantSelect+`
+		WHERE p.stage_id = $1
+		ORDER BY p.created_at, p.id`, stageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []StageParticipant{}
+	for rows.Next() {
+		p, err := scanStageParticipant(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (h *Handler) loadStageParticipant(stageID, participantID int) (StageParticipant, error) {
+	return scanStageParticipant(h.DB.QueryRow(stageParticipantSelect+`
+		WHERE p.stage_id = $1 AND p.id = $2`, stageID, participantID))
+}
+
+/*
+	PATCH /api/stages/{id}
+
+Request-Body (all fields optional):
+
+	{
+	  "name": "Webinar Oktober",
+	  "slug": "webinar-oktober",
+	  "date": "2025-10-14",
+	  "ad_budget": 1500
+	}
+
+"date": "" and "ad_budget": null clear the value. Counters stay with
+PATCH /api/stages/{id}/stats.
+*/
+func (h *Handler) UpdateStage(w http.ResponseWriter, r *http.Request) {
+	stageID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid stage id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name     *string         `json:"name"`
+		Slug     *string         `json:"slug"`
+		Date     *string         `json:"date"`
+		AdBudget json.RawMessage `json:"ad_budget"` // nil = unchanged, null = clear
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		http.Error(w, "name must not be empty", http.StatusBadRequest)
+		return
+	}
+	if req.Slug != nil {
+		slug := slugify(*req.Slug)
+		if slug == "" {
+			http.Error(w, "invalid slug", http.StatusBadRequest)
+			return
+		}
+		req.Slug = &slug
+	}
+	if req.Date != nil && *req.Date != "" {
+		if _, err := time.Parse("2006-01-02", *req.Date); err != nil {
+			http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	var adBudget *float64
+	if req.AdBudget != nil {
+		if err := json.Unmarshal(req.AdBudget, &adBudget); err != nil {
+			http.Error(w, "ad_budget must be a number or null", http.StatusBadRequest)
+			return
+		}
+		if adBudget != nil && *adBudget < 0 {
+			http.Error(w, "ad_budget must be >= 0", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var id int
+	err = h.DB.QueryRow(`
+		UPDATE stages
+		SET name      = COALESCE($1, name),
+		    slug      = COALESCE($2, slug),
+		    date      = CASE WHEN $3::text IS NULL THEN date ELSE NULLIF($3, '')::date END,
+		    ad_budget = CASE WHEN $4::boolean THEN $5::numeric ELSE ad_budget END
+		WHERE id = $6
+		RETURNING id`,
+		req.Name, req.Slug, req.Date, req.AdBudget != nil, adBudget, stageID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "stage not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "stages_slug_uidx") {
+			http.Error(w, "slug already in use", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := h.loadStage(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s)
+}
+
+// DELETE /api/stages/{id}
+// Participants and assignments are deleted with the stage; clients and
+// sales processes keep existing and lose their stage reference, ad spend
+// becomes unassigned.
+func (h *Handler) DeleteStage(w http.ResponseWriter, r *http.Request) {
+	stageID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid stage id", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "begin tx: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// The stage's ad spend becomes unassigned (ON DELETE SET NULL). Rows that
+	// would then collide with an unassigned row of the same channel, day and
+	// campaign on ad_spend_entries_uidx are merged into it first.
+	if _, err := tx.Exec(`
+		WITH merged AS (
+			DELETE FROM ad_spend_entries s
+			USING ad_spend_entries u
+			WHERE s.stage_id = $1
+			  AND u.stage_id IS NULL
+			  AND u.channel = s.channel
+			  AND u.spend_date = s.spend_date
+			  AND COALESCE(u.campaign, '') = COALESCE(s.campaign, '')
+			RETURNING u.id AS into_id, s.amount
+		)
+		UPDATE ad_spend_entries u
+		SET amount = u.amount + merged.amount
+		FROM merged
+		WHERE u.id = merged.into_id`, stageID); err != nil {
+		http.Error(w, "merge ad spend: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res, err := tx.Exec(`DELETE FROM stages WHERE id = $1`, stageID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "stage not found", http.StatusNotFound)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // POST /api/stages
+// Registrations/participants given on create are aggregate-only numbers,
+// so they switch stats_override on.
 func (h *Handler) CreateStage(w http.ResponseWriter, r *http.Request) {
 	var s Stage
 	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	override := s.StatsOverride || s.Registrations != nil || s.Participants != nil
 
+	// slug defaults to the slugified name; on collision the id is appended
+	slug := ""
+	if s.Slug != nil {
+		slug = slugify(*s.Slug)
+	}
+	if slug == "" {
+		slug = slugify(s.Name)
+	}
 	err := h.DB.QueryRow(
-		`INSERT INTO stages (name, date, ad_budget, registrations, participants)
-		 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
-		s.Name, s.Date, s.AdBudget, s.Registrations, s.Participants,
+		`INSERT INTO stages (name, slug, date, ad_budget, registrations, participants, stats_override)
+		 VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7)
+		 ON CONFLICT (slug) DO NOTHING
+		 RETURNING id`,
+		s.Name, slug, s.Date, s.AdBudget, s.Registrations, s.Participants, override,
 	).Scan(&s.ID)
+	if err == sql.ErrNoRows {
+		err = h.DB.QueryRow(
+			`INSERT INTO stages (name, date, ad_budget, registrations, participants, stats_override)
+			 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+			s.Name, s.Date, s.AdBudget, s.Registrations, s.Participants, override,
+		).Scan(&s.ID)
+		if err == nil {
+			_, err = h.DB.Exec(`UPDATE stages SET slug = $1 || '-' || id WHERE id = $2`, slug, s.ID)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err = h.loadStage(s.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -64,6 +487,47 @@ func (h *Handler) CreateStage(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(s)
 }
 
+type StageParticipantRequest struct {
+	ClientID  *int    `json:"client_id,omitempty"`
+	LeadName  *string `json:"lead_name,omitempty"`
+	LeadEmail *string `json:"lead_email,omitempty"`
+	LeadPhone *string `json:"lead_phone,omitempty"`
+	Attended  bool    `json:"attended"`
+}
+
+// queryRower is satisfied by *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// GET /api/stages/{id}/participants
+func (h *Handler) ListStageParticipants(w http.ResponseWriter, r *http.Request) {
+	stageID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid stage id", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	if err := h.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM stages WHERE id = $1)`, stageID).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "stage not found", http.StatusNotFound)
+		return
+	}
+
+	out, err := h.loadStageParticipants(stageID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
 /*
 	POST /api/stages/{id}/participants
 
@@ -91,13 +555,7 @@ func (h *Handler) AddStageParticipant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		ClientID  *int    `json:"client_id,omitempty"`
-		LeadName  *string `json:"lead_name,omitempty"`
-		LeadEmail *string `json:"lead_email,omitempty"`
-		LeadPhone *string `json:"lead_phone,omitempty"`
-		Attended  bool    `json:"attended"`
-	}
+	var req StageParticipantRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -109,30 +567,79 @@ func (h *Handler) AddStageParticipant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var insertErr error
+	participantID, err := insertStageParticipant(h.DB, stageID, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.emitParticipantAdded(participantID, stageID, req)
+
+	p, err := h.loadStageParticipant(stageID, participantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+var slugRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify lowercases s, folds umlauts and joins the remaining words with '-'.
+func slugify(s string) string {
+	s = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss").Replace(strings.ToLower(s))
+	return strings.Trim(slugRe.ReplaceAllString(s, "-"), "-")
+}
+
+// insertStageParticipant stores either a client link or the lead fields.
+func insertStageParticipant(q queryRower, stageID int, req StageParticipantRequest) (int, error) {
+	var id int
+	var err error
 	if req.ClientID != nil {
-		_, insertErr = h.DB.Exec(
+		err = q.QueryRow(
 			`INSERT INTO stage_participants (stage_id, linked_client_id, attended)
-			 VALUES ($1, $2, $3)`,
+			 VALUES ($1, $2, $3) RETURNING id`,
 			stageID, *req.ClientID, req.Attended,
-		)
+		).Scan(&id)
 	} else {
-		_, insertErr = h.DB.Exec(
+		err = q.QueryRow(
 			`INSERT INTO stage_participants (stage_id, lead_name, lead_email, lead_phone, attended)
-			 VALUES ($1, $2, $3, $4, $5)`,
+			 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
 			stageID, req.LeadName, req.LeadEmail, req.LeadPhone, req.Attended,
-		)
-	}
-	if insertErr != nil {
-		http.Error(w, insertErr.Error(), http.StatusInternalServerError)
-		return
+		).Scan(&id)
 	}
+	return id, err
+}
 
-	w.WriteHeader(http.StatusCreated)
+func (h *Handler) emitParticipantAdded(participantID, stageID int, req StageParticipantRequest) {
+	h.emitEvent(EventStageParticipantAdd, map[string]any{
+		"id":         participantID,
+		"stage_id":   stageID,
+		"client_id":  req.ClientID,
+		"lead_name":  req.LeadName,
+		"lead_email": req.LeadEmail,
+		"lead_phone": req.LeadPhone,
+		"attended":   req.Attended,
+	})
 }
 
-// PATCH /api/stages/{id}/participants/{participant_id}
-// Update a single participant (e.g., mark attended after event)
+/*
+	PATCH /api/stages/{id}/participants/{participant_id}
+
+Update a single participant (e.g., mark attended after event, fix lead data).
+All fields optional; an empty string clears a lead field. lead_name can
+only be cleared on participants linked to a client.
+
+	{
+	  "attended": true,
+	  "lead_name": "Laura Beispiel",
+	  "lead_email": "laura@example.com",
+	  "lead_phone": ""
+	}
+*/
 func (h *Handler) UpdateStageParticipant(w http.ResponseWriter, r *http.Request) {
 	stageIDStr := chi.URLParam(r, "id")
 	participantIDStr := chi.URLParam(r, "participant_id")
@@ -149,29 +656,113 @@ func (h *Handler) UpdateStageParticipant(w http.ResponseWriter, r *http.Request)
 	}
 
 	var req struct {
-		Attended *bool `json:"attended,omitempty"`
+		Attended  *bool   `json:"attended,omitempty"`
+		LeadName  *string `json:"lead_name,omitempty"`
+		LeadEmail *string `json:"lead_email,omitempty"`
+		LeadPhone *string `json:"lead_phone,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if req.LeadEmail != nil && *req.LeadEmail != "" {
+		addr, err := mail.ParseAddress(*req.LeadEmail)
+		if err != nil {
+			http.Error(w, "invalid lead_email", http.StatusBadRequest)
+			return
+		}
+		req.LeadEmail = &addr.Address
+	}
+
+	if req.LeadName != nil {
+		name := strings.TrimSpace(*req.LeadName)
+		req.LeadName = &name
+	}
 
-	_, err = h.DB.Exec(`
+	// COALESCE keeps omitted fields, NULLIF turns "" into NULL; a lead
+	// without a client keeps its name
+	res, err := h.DB.Exec(`
 		UPDATE stage_participants
-		SET attended = COALESCE($1, attended)
-		WHERE id = $2 AND stage_id = $3`,
-		req.Attended, participantID, stageID,
+		SET attended   = COALESCE($1, attended),
+		    lead_name  = CASE WHEN $2::text IS NULL THEN lead_name  ELSE NULLIF($2, '') END,
+		    lead_email = CASE WHEN $3::text IS NULL THEN lead_email ELSE NULLIF($3, '') END,
+		    lead_phone = CASE WHEN $4::text IS NULL THEN lead_phone ELSE NULLIF($4, '') END
+		WHERE id = $5 AND stage_id = $6
+		  AND (linked_client_id IS NOT NULL OR $2 IS DISTINCT FROM '')`,
+		req.Attended, req.LeadName, req.LeadEmail, req.LeadPhone, participantID, stageID,
 	)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var exists bool
+		if err := h.DB.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM stage_participants WHERE id = $1 AND stage_id = $2)`,
+			participantID, stageID,
+		).Scan(&exists); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if exists {
+			http.Error(w, "lead_name is required for participants without a client", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "participant not found", http.StatusNotFound)
+		return
+	}
 
+	p, err := h.loadStageParticipant(stageID, participantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// DELETE /api/stages/{id}/participants/{participant_id}
+func (h *Handler) DeleteStageParticipant(w http.ResponseWriter, r *http.Request) {
+	stageID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid stage id", http.StatusBadRequest)
+		return
+	}
+	participantID, err := strconv.Atoi(chi.URLParam(r, "participant_id"))
+	if err != nil {
+		http.Error(w, "invalid participant id", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.DB.Exec(
+		`DELETE FROM stage_participants WHERE id = $1 AND stage_id = $2`,
+		participantID, stageID,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "participant not found", http.StatusNotFound)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// PATCH /api/stages/{id}/stats
-// Update aggregated numbers like registrations and participants count
+/*
+	PATCH /api/stages/{id}/stats
+
+Manual aggregate numbers for events without participant rows. They are
+stored always but only used while stats_override is true; otherwise the
+numbers are counted from stage_participants.
+
+	{
+	  "registrations": 120,
+	  "participants": 64,
+	  "stats_override": true
+	}
+*/
 func (h *Handler) UpdateStageStats(w http.ResponseWriter, r *http.Request) {
 	stageIDStr := chi.URLParam(r, "id")
 	stageID, err := strconv.Atoi(stageIDStr)
@@ -181,25 +772,31 @@ func (h *Handler) UpdateStageStats(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Registrations *int `json:"registrations,omitempty"`
-		Participants  *int `json:"participants,omitempty"`
+		Registrations *int  `json:"registrations,omitempty"`
+		Participants  *int  `json:"participants,omitempty"`
+		StatsOverride *bool `json:"stats_override,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	_, err = h.DB.Exec(`
+	res, err := h.DB.Exec(`
 		UPDATE stages
-		SET registrations = COALESCE($1, registrations),
-		    participants  = COALESCE($2, participants)
-		WHERE id = $3`,
-		req.Registrations, req.Participants, stageID,
+		SET registrations  = COALESCE($1, registrations),
+		    participants   = COALESCE($2, participants),
+		    stats_override = COALESCE($3, stats_override)
+		WHERE id = $4`,
+		req.Registrations, req.Participants, req.StatsOverride, stageID,
 	)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "stage not found", http.StatusNotFound)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -231,3 +828,254 @@ func (h *Handler) AssignClientToStage(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusCreated)
 }
+
+type ConvertParticipantRequest struct {
+	ClientID           *int    `json:"client_id,omitempty"` // link this client instead of matching/creating one
+	Source             string  `json:"source,omitempty"`    // organic | paid; default: paid if the stage had an ad budget
+	StartSalesProcess  bool    `json:"start_sales_process"`
+	ZweitgespraechDate *string `json:"zweitgespraech_date,omitempty"` // implies start_sales_process
+}
+
+type ConvertParticipantResponse struct {
+	Participant    StageParticipant        `json:"participant"`
+	Client         StartSalesProcessClient `json:"client"`
+	ClientCreated  bool                    `json:"client_created"`
+	SalesProcessID *int                    `json:"sales_process_id,omitempty"`
+}
+
+/*
+	POST /api/stages/{id}/participants/{participant_id}/convert
+
+Turns a participant lead into a client: links client_id, an already linked
+client or a client with the same email, otherwise creates one from the lead
+fields. The client gets source_stage_id (if unset) and a stage assignment.
+With start_sales_process or a zweitgespraech_date a sales process is
+started. Everything runs in one transaction.
+
+	{
+	  "start_sales_process": true,
+	  "zweitgespraech_date": "2025-11-04"
+	}
+*/
+func (h *Handler) ConvertStageParticipant(w http.ResponseWriter, r *http.Request) {
+	stageID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid stage id", http.StatusBadRequest)
+		return
+	}
+	participantID, err := strconv.Atoi(chi.URLParam(r, "participant_id"))
+	if err != nil {
+		http.Error(w, "invalid participant id", http.StatusBadRequest)
+		return
+	}
+
+	var req ConvertParticipantRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Source != "" && req.Source != "organic" && req.Source != "paid" {
+		http.Error(w, "source must be organic or paid", http.StatusBadRequest)
+		return
+	}
+	if req.ZweitgespraechDate != nil {
+		if _, err := time.Parse("2006-01-02", *req.ZweitgespraechDate); err != nil {
+			http.Error(w, "zweitgespraech_date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		req.StartSalesProcess = true
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "begin tx: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		linkedID                   *int
+		leadName, leadEmail, phone *string
+		adBudget                   *float64
+	)
+	err = tx.QueryRow(`
+		SELECT p.linked_client_id, p.lead_name, p.lead_email, p.lead_phone, s.ad_budget
+		FROM stage_participants p
+		JOIN stages s ON s.id = p.stage_id
+		WHERE p.id = $1 AND p.stage_id = $2
+		FOR UPDATE OF p`, participantID, stageID,
+	).Scan(&linkedID, &leadName, &leadEmail, &phone, &adBudget)
+	if err == sql.ErrNoRows {
+		http.Error(w, "participant not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	source := req.Source
+	if source == "" {
+		source = "organic"
+		if adBudget != nil && *adBudget > 0 {
+			source = "paid"
+		}
+	}
+
+	// pick the client: explicit > already linked > same email
+	clientID := req.ClientID
+	if clientID == nil {
+		clientID = linkedID
+	}
+	if clientID == nil && derefString(leadEmail) != "" {
+		var id int
+		err := tx.QueryRow(`
+			SELECT id FROM clients WHERE lower(email) = lower($1) ORDER BY id LIMIT 1`,
+			*leadEmail,
+		).Scan(&id)
+		if err != nil && err != sql.ErrNoRows {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err == nil {
+			clientID = &id
+		}
+	}
+
+	var resp ConvertParticipantResponse
+	var started *StartSalesProcessResponse
+
+	if clientID == nil {
+		// new client from the lead fields
+		if derefString(leadName) == "" {
+			http.Error(w, "participant has no lead_name", http.StatusUnprocessableEntity)
+			return
+		}
+		cl := StartSalesProcessClient{
+			Name:          *leadName,
+			Email:         derefString(leadEmail),
+			Phone:         derefString(phone),
+			Source:        source,
+			SourceStageID: &stageID,
+		}
+		if req.StartSalesProcess {
+			out, err := startSalesProcessTx(tx, StartSalesProcessRequest{
+				Name:               cl.Name,
+				Email:              cl.Email,
+				Phone:              cl.Phone,
+				Source:             cl.Source,
+				SourceStageID:      &stageID,
+				ZweitgespraechDate: req.ZweitgespraechDate,
+			})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			started = &out
+			cl.ID = out.Client.ID
+			resp.SalesProcessID = &out.SalesProcessID
+		} else if err := tx.QueryRow(
+			`INSERT INTO clients (name, email, phone, source, source_stage_id, status)
+			 VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, 'awaiting_response')
+			 RETURNING id`,
+			cl.Name, cl.Email, cl.Phone, cl.Source, stageID,
+		).Scan(&cl.ID); err != nil {
+			http.Error(w, "insert client: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Client, resp.ClientCreated = cl, true
+	} else {
+		// existing client: attribute to this stage unless already attributed
+		var cl StartSalesProcessClient
+		var email, phone, src *string
+		err := tx.QueryRow(`
+			UPDATE clients
+			SET source_stage_id = COALESCE(source_stage_id, $1)
+			WHERE id = $2
+			RETURNING id, name, email, phone, source, source_stage_id`,
+			stageID, *clientID,
+		).Scan(&cl.ID, &cl.Name, &email, &phone, &src, &cl.SourceStageID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "client not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		cl.Email, cl.Phone, cl.Source = derefString(email), derefString(phone), derefString(src)
+		resp.Client = cl
+
+		if req.StartSalesProcess {
+			var spID int
+			err := tx.QueryRow(`
+				INSERT INTO sales_process (client_id, stage, zweitgespraech_date, stage_id)
+				VALUES ($1, 'zweitgespraech', $2, $3)
+				ON CONFLICT (client_id) DO NOTHING
+				RETURNING id`, cl.ID, req.ZweitgespraechDate, stageID,
+			).Scan(&spID)
+			if err == sql.ErrNoRows {
+				http.Error(w, "client already has a sales process", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, "insert sales_process: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			out := StartSalesProcessResponse{SalesProcessID: spID, Client: cl}
+			out.SalesProcess = StartSalesProcessDTO{
+				ID:                 spID,
+				ClientID:           cl.ID,
+				Stage:              "zweitgespraech",
+				ZweitgespraechDate: req.ZweitgespraechDate,
+				StageID:            &stageID,
+			}
+			started = &out
+			resp.SalesProcessID = &spID
+		}
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO stage_client_assignments (client_id, stage_id)
+		SELECT $1, $2
+		WHERE NOT EXISTS (
+			SELECT 1 FROM stage_client_assignments WHERE client_id = $1 AND stage_id = $2
+		)`, resp.Client.ID, stageID,
+	); err != nil {
+		http.Error(w, "assign client: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(
+		`UPDATE stage_participants SET linked_client_id = $1 WHERE id = $2`,
+		resp.Client.ID, participantID,
+	); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if started != nil {
+		h.emitSalesStarted(*started, resp.ClientCreated)
+	} else if resp.ClientCreated {
+		h.emitEvent(EventClientCreated, resp.Client)
+	}
+
+	if resp.Participant, err = h.loadStageParticipant(stageID, participantID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if resp.ClientCreated || resp.SalesProcessID != nil {
+		status = http.StatusCreated
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,298 @@
+// api/tokens.go
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
+)
+
+// Personal API tokens act as their owner (same role) but only within
+// their scopes: "read:<area>" or "write:<area>", where the area is set per
+// route group in the router (RequireScope). write implies read; routes
+// without an area are closed to tokens.
+var tokenScopeAreas = []string{
+	"clients", "sales", "stages", "attribution",
+	"contracts", "ad-spend", "expenses", "cashflow", "revenue",
+	"bank-imports", "sepa", "dunning",
+	"settings", "email", "webhooks", "admin",
+}
+
+const apiTokenPrefix = "sat_"
+
+type APIToken struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	ExpiresAt  string   `json:"expires_at"`
+	LastUsedAt *string  `json:"last_used_at,omitempty"`
+	CreatedAt  *string  `json:"created_at,omitempty"`
+	Token      string   `json:"token,omitempty"` // plain token, only in the create response
+}
+
+const apiTokenColumns = `
+	t.id, t.name, t.prefix, t.scopes,
+	to_char(t.expires_at, 'YYYY-MM-DD"T"HH24:MI:SSZ'),
+	to_char(t.last_used_at, 'YYYY-MM-DD"T"HH24:MI:SSZ'),
+	to_char(t.created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')`
+
+func scanAPIToken(sc interface{ Scan(...any) error }) (APIToken, error) {
+	var t APIToken
+	err := sc.Scan(&t.ID, &t.Name, &t.Prefix, pq.Array(&t.Scopes), &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+	return t, err
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func validTokenScope(scope string) bool {
+	access, area, ok := strings.Cut(scope, ":")
+	if !ok || (access != "read" && access != "write") {
+		return false
+	}
+	for _, a := range tokenScopeAreas {
+		if a == area {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token from "Authorization: Bearer ...".
+func bearerToken(r *http.Request) (string, bool) {
+	v := r.Header.Get("Authorization")
+	if len(v) < 7 || !strings.EqualFold(v[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(v[7:]), true
+}
+
+// tokenSession resolves a personal API token to a session of its owner.
+func (h *Handler) tokenSession(token string) (*Session, bool) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, false
+	}
+	var s Session
+	err := h.DB.QueryRow(`
+		SELECT t.id, u.email, COALESCE(u.name, ''), u.role, t.scopes, t.expires_at
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1
+		  AND t.revoked_at IS NULL
+		  AND t.expires_at > now()
+		  AND u.status <> 'disabled'`, hashAPIToken(token),
+	).Scan(&s.TokenID, &s.Email, &s.Name, &s.Role, pq.Array(&s.Scopes), &s.Exp)
+	if err != nil {
+		return nil, false
+	}
+	// last_used_at is informational; minute precision is enough
+	_, _ = h.DB.Exec(`
+		UPDATE api_tokens SET last_used_at = now()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')`, s.TokenID)
+	return &s, true
+}
+
+// tokenAllows checks the request against the token scopes for area.
+func tokenAllows(s *Session, r *http.Request, area string) bool {
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+	for _, sc := range s.Scopes {
+		if sc == "write:"+area || (read && sc == "read:"+area) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope tags routes with their token scope area: token sessions
+// need read:<area> or write:<area>, cookie sessions pass. Must run after
+// RequireAuth and before RequireRole, which refuses token sessions that
+// no RequireScope has checked.
+func (h *Handler) RequireScope(area string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sess := currentSession(r)
+			if sess == nil || sess.TokenID == 0 || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !tokenAllows(sess, r, area) {
+				http.Error(w, "token scope does not allow this request", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeCtxKey, area)))
+		})
+	}
+}
+
+// RequireCookieSession closes routes to personal API tokens.
+func (h *Handler) RequireCookieSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sess := currentSession(r); sess != nil && sess.TokenID != 0 {
+			http.Error(w, "token scope does not allow this request", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// scopeChecked reports whether RequireScope admitted the request.
+func scopeChecked(r *http.Request) bool {
+	_, ok := r.Context().Value(scopeCtxKey).(string)
+	return ok
+}
+
+// GET /api/me/tokens
+func (h *Handler) ListAPITokens(w http.ResponseWriter, r *http.Request) {
+	sess := currentSession(r)
+	if sess == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT`+apiTokenColumns+`
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE lower(u.email) = lower($1)
+		  AND t.revoked_at IS NULL
+		ORDER BY t.created_at DESC`, sess.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+/*
+	POST /api/me/tokens
+
+Request-Body:
+
+	{
+	  "name": "monthly report script",
+	  "scopes": ["read:cashflow", "read:contracts"],
+	  "expires_in_days": 90
+	}
+
+The plain token is returned once and never stored.
+*/
+func (h *Handler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	sess := currentSession(r)
+	if sess == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "at least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, sc := range req.Scopes {
+		if !validTokenScope(sc) {
+			http.Error(w, fmt.Sprintf("unknown scope %q (read:<area> or write:<area>, areas: %s)",
+				sc, strings.Join(tokenScopeAreas, ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = 90
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > 365 {
+		http.Error(w, "expires_in_days must be between 1 and 365", http.StatusBadRequest)
+		return
+	}
+
+	token := apiTokenPrefix + randHex(24)
+	t, err := scanAPIToken(h.DB.QueryRow(`
+		INSERT INTO api_tokens AS t (user_id, name, prefix, token_hash, scopes, expires_at)
+		SELECT id, $2, $3, $4, $5, $6
+		FROM users WHERE lower(email) = lower($1)
+		RETURNING`+apiTokenColumns,
+		sess.Email, req.Name, token[:len(apiTokenPrefix)+6], hashAPIToken(token), pq.Array(req.Scopes),
+		time.Now().AddDate(0, 0, req.ExpiresInDays),
+	))
+	if err == sql.ErrNoRows {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t.Token = token
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(t)
+}
+
+// DELETE /api/me/tokens/{id}
+func (h *Handler) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	sess := currentSession(r)
+	if sess == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid token id", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.DB.Exec(`
+		UPDATE api_tokens t SET revoked_at = now()
+		FROM users u
+		WHERE u.id = t.user_id
+		  AND t.id = $1
+		  AND lower(u.email) = lower($2)
+		  AND t.revoked_at IS NULL`, id, sess.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "token not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestTokenScopes(t *testing.T) {
+	h := &Handler{}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r := chi.NewRouter()
+	r.Group(func(g chi.Router) {
+		g.Use(h.RequireScope("clients"), h.RequireRole(allRoles, allRoles))
+		g.Get("/clients", ok)
+		g.Post("/clients", ok)
+	})
+	r.Group(func(g chi.Router) {
+		g.Use(h.RequireScope("sepa"), h.RequireRole(allRoles, allRoles))
+		g.Put("/clients/{id}/sepa-mandate", ok)
+	})
+	r.Group(func(g chi.Router) {
+		g.Use(h.RequireRole(allRoles, allRoles))
+		g.Get("/audit", ok)
+	})
+	r.Group(func(g chi.Router) {
+		g.Use(h.RequireCookieSession)
+		g.Get("/me/tokens", ok)
+	})
+
+	tests := []struct {
+		scopes []string // nil = cookie session
+		method string
+		path   string
+		want   int
+	}{
+		{nil, http.MethodPut, "/clients/1/sepa-mandate", http.StatusOK},
+		{nil, http.MethodGet, "/audit", http.StatusOK},
+		{nil, http.MethodGet, "/me/tokens", http.StatusOK},
+		{[]string{"read:clients"}, http.MethodGet, "/clients", http.StatusOK},
+		{[]string{"read:clients"}, http.MethodPost, "/clients", http.StatusForbidden},
+		{[]string{"write:clients"}, http.MethodPost, "/clients", http.StatusOK},
+		// same path prefix, different area
+		{[]string{"write:clients"}, http.MethodPut, "/clients/1/sepa-mandate", http.StatusForbidden},
+		{[]string{"write:sepa"}, http.MethodPut, "/clients/1/sepa-mandate", http.StatusOK},
+		// no area: closed to tokens
+		{[]string{"write:admin"}, http.MethodGet, "/audit", http.StatusForbidden},
+		{[]string{"write:clients"}, http.MethodGet, "/me/tokens", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		sess := &Session{Role: RoleAdmin}
+		if tt.scopes != nil {
+			sess.TokenID, sess.Scopes = 1, tt.scopes
+		}
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req = req.WithContext(withSession(req.Context(), sess))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%v %s %s: status %d, want %d", tt.scopes, tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// api/users.go
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type User struct {
+	ID          int     `json:"id"`
+	Email       string  `json:"email"`
+	Name        *string `json:"name,omitempty"`
+	Role        string  `json:"role"`
+	Status      string  `json:"status"` // invited | active | disabled
+	InvitedBy   *string `json:"invited_by,omitempty"`
+	LastLoginAt *string `json:"last_login_at,omitempty"`
+	CreatedAt   *string `json:"created_at,omitempty"`
+	UpdatedAt   *string `json:"updated_at,omitempty"`
+}
+
+const userColumns = `
+	id, email, name, role, status, invited_by,
+	to_char(last_login_at, 'YYYY-MM-DD"T"HH24:MI:SSZ'),
+	to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ'),
+	to_char(updated_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')`
+
+func scanUser(sc interface{ Scan(...any) error }) (User, error) {
+	var u User
+	err := sc.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.Status, &u.InvitedBy,
+		&u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt)
+	return u, err
+}
+
+// GET /api/admin/users?status=invited
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(`
+		SELECT`+userColumns+`
+		FROM users
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY lower(email)`, r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, u)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+/*
+	POST /api/admin/users
+
+Invites a user: they can sign in right away and become active on first
+login.
+
+Request-Body:
+
+	{
+	  "email": "anna@example.com",
+	  "name": "Anna",
+	  "role": "bookkeeper"
+	}
+*/
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+		Name  string `json:"name"`
+		Role  string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = RoleSales
+	}
+	if !validRole(req.Role) {
+		http.Error(w, "role must be admin, sales or bookkeeper", http.StatusBadRequest)
+		return
+	}
+
+	var invitedBy *string
+	if sess := currentSession(r); sess != nil {
+		invitedBy = &sess.Email
+	}
+
+	u, err := scanUser(h.DB.QueryRow(`
+		INSERT INTO users (email, name, role, status, invited_by)
+		VALUES (lower($1), NULLIF($2, ''), $3, 'invited', $4)
+		ON CONFLICT ((lower(email))) DO NOTHING
+		RETURNING`+userColumns,
+		addr.Address, strings.TrimSpace(req.Name), req.Role, invitedBy,
+	))
+	if err == sql.ErrNoRows {
+		http.Error(w, "user already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(u)
+}
+
+// PATCH /api/admin/users/{id}  {"role": "sales", "name": "Anna"}
+// The last admin cannot be demoted or disabled.
+func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name *string `json:"name"`
+		Role *string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Role != nil && !validRole(*req.Role) {
+		http.Error(w, "role must be admin, sales or bookkeeper", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "begin tx: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	u, err := scanUser(tx.QueryRow(`
+		UPDATE users
+		SET name = COALESCE($1, name),
+		    role = COALESCE($2, role),
+		    updated_at = now()
+		WHERE id = $3
+		RETURNING`+userColumns,
+		req.Name, req.Role, id,
+	))
+	if err == sql.ErrNoRows {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ensureAdminLeft(tx); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(u)
+}
+
+// POST /api/admin/users/{id}/disable
+// Refuses further logins and rejects the user's existing sessions at once.
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserStatus(w, r, `
+		WITH revoked AS (
+		  UPDATE sessions SET revoked_at = now()
+		  WHERE user_id = $1 AND revoked_at IS NULL
+		)
+		UPDATE users
+		SET status = 'disabled', updated_at = now()
+		WHERE id = $1
+		RETURNING`+userColumns)
+}
+
+// POST /api/admin/users/{id}/enable
+// Back to active, or invited if the user never signed in. Sessions ended
+// by disabling stay revoked.
+func (h *Handler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserStatus(w, r, `
+		UPDATE users
+		SET status = CASE WHEN last_login_at IS NULL THEN 'invited' ELSE 'active' END,
+		    updated_at = now()
+		WHERE id = $1
+		RETURNING`+userColumns)
+}
+
+func (h *Handler) setUserStatus(w http.ResponseWriter, r *http.Request, query string) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "begin tx: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	u, err := scanUser(tx.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ensureAdminLeft(tx); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(u)
+}
+
+// ensureAdminLeft fails when a change inside tx removed the last enabled admin.
+func ensureAdminLeft(tx *sql.Tx) error {
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE role = 'admin' AND status <> 'disabled'`).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("at least one admin is required")
+	}
+	return nil
+}
+
+// DELETE /api/admin/users/{id}/identities
+// Unbinds the user's sign-in accounts; the next sign-in binds again by
+// email (e.g. after the user's provider account was replaced).
+func (h *Handler) ResetUserIdentities(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+	var exists bool
+	if err := h.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, id).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if _, err := h.DB.Exec(`DELETE FROM user_identities WHERE user_id = $1`, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,537 @@
+// api/webhooks.go
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
+)
+
+// Domain event types delivered to webhook endpoints.
+const (
+	EventClientCreated       = "client.created"
+	EventSalesStageChanged   = "sales.stage_changed"
+	EventContractCreated     = "contract.created"
+	EventPaymentReceived     = "payment.received"
+	EventStageParticipantAdd = "stage.participant_added"
+)
+
+var webhookEventTypes = map[string]bool{
+	EventClientCreated:       true,
+	EventSalesStageChanged:   true,
+	EventContractCreated:     true,
+	EventPaymentReceived:     true,
+	EventStageParticipantAdd: true,
+}
+
+type WebhookEndpoint struct {
+	ID          int      `json:"id"`
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret,omitempty"` // only returned on create
+	Events      []string `json:"events"`           // empty = all
+	Active      bool     `json:"active"`
+	Description *string  `json:"description,omitempty"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int     `json:"id"`
+	EndpointID     int     `json:"endpoint_id"`
+	EventID        int     `json:"event_id"`
+	EventType      string  `json:"event_type"`
+	Status         string  `json:"status"` // pending | sending | delivered | failed
+	Attempts       int     `json:"attempts"`
+	LastStatusCode *int    `json:"last_status_code,omitempty"`
+	LastError      *string `json:"last_error,omitempty"`
+	ReplayOf       *int    `json:"replay_of,omitempty"`
+	CreatedAt      string  `json:"created_at"`
+	DeliveredAt    *string `json:"delivered_at,omitempty"`
+}
+
+// GET /api/webhooks
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(`
+		SELECT id, url, events, active, description,
+		       to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')
+		FROM webhook_endpoints
+		ORDER BY id`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []WebhookEndpoint{}
+	for rows.Next() {
+		var e WebhookEndpoint
+		if err := rows.Scan(&e.ID, &e.URL, pq.Array(&e.Events), &e.Active, &e.Description, &e.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+/*
+	POST /api/webhooks
+
+	{
+	  "url": "https://hooks.example.com/sales",
+	  "events": ["client.created", "contract.created"],   // optional, default all
+	  "description": "Newsletter tool"
+	}
+
+The response contains the signing secret; it is not shown again.
+*/
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var e WebhookEndpoint
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateWebhookURL(e.URL, h.isLocal()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateWebhookEvents(e.Events); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if e.Events == nil {
+		e.Events = []string{}
+	}
+	e.Secret = "whsec_" + randHex(24)
+	e.Active = true
+
+	err := h.DB.QueryRow(`
+		INSERT INTO webhook_endpoints (url, secret, events, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')`,
+		e.URL, e.Secret, pq.Array(e.Events), e.Description,
+	).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(e)
+}
+
+// PATCH /api/webhooks/{id}
+// Body: any of { "url", "events", "active", "description" }
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		URL         *string   `json:"url,omitempty"`
+		Events      *[]string `json:"events,omitempty"`
+		Active      *bool     `json:"active,omitempty"`
+		Description *string   `json:"description,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL, h.isLocal()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var events any // nil keeps the current subscription
+	if req.Events != nil {
+		if err := validateWebhookEvents(*req.Events); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		list := *req.Events
+		if list == nil {
+			list = []string{}
+		}
+		events = pq.Array(list)
+	}
+
+	res, err := h.DB.Exec(`
+		UPDATE webhook_endpoints
+		SET url         = COALESCE($1, url),
+		    events      = COALESCE($2, events),
+		    active      = COALESCE($3, active),
+		    description = COALESCE($4, description)
+		WHERE id = $5`,
+		req.URL, events, req.Active, req.Description, id,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /api/webhooks/{id}
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.DB.Exec(`DELETE FROM webhook_endpoints WHERE id = $1`, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/webhooks/{id}/deliveries?status=failed
+func (h *Handler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT d.id, d.endpoint_id, d.event_id, e.type, d.status, d.attempts,
+		       d.last_status_code, d.last_error, d.replay_of,
+		       to_char(d.created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ'),
+		       to_char(d.delivered_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')
+		FROM webhook_deliveries d
+		JOIN webhook_events e ON e.id = d.event_id
+		WHERE d.endpoint_id = $1
+		  AND ($2 = '' OR d.status = $2)
+		ORDER BY d.created_at DESC, d.id DESC
+		LIMIT 500`, id, r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &d.Status, &d.Attempts,
+			&d.LastStatusCode, &d.LastError, &d.ReplayOf, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, d)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// POST /api/webhooks/deliveries/{id}/replay
+// Queues a new delivery of the same event to the same endpoint.
+func (h *Handler) ReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid delivery id", http.StatusBadRequest)
+		return
+	}
+
+	var newID int
+	err = h.DB.QueryRow(`
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, replay_of)
+		SELECT endpoint_id, event_id, id FROM webhook_deliveries WHERE id = $1
+		RETURNING id`, id).Scan(&newID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]int{"id": newID})
+}
+
+// validateWebhookURL requires https and a public host; local mode also
+// accepts http and private hosts for receivers on the dev machine.
+// webhookDialControl enforces the same at connect time, after DNS.
+func validateWebhookURL(rawURL string, local bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	if local {
+		return nil
+	}
+	if u.Scheme != "https" {
+		return errors.New("url must use https")
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ip := net.ParseIP(host); ip != nil && !publicIP(ip) {
+		return errors.New("url must not point to a private or local address")
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") ||
+		strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal") {
+		return errors.New("url must not point to a private or local address")
+	}
+	return nil
+}
+
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP is false for loopback, private, link-local (169.254.169.254
+// metadata), CGNAT, multicast and unspecified addresses.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || cgnat.Contains(ip))
+}
+
+// webhookDialControl refuses connections to non-public addresses, so a
+// hostname that resolves (or is rebound) to one is caught as well.
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("webhook: refusing to connect to %s", host)
+	}
+	return nil
+}
+
+func validateWebhookEvents(events []string) error {
+	for _, ev := range events {
+		if !webhookEventTypes[ev] {
+			return fmt.Errorf("unknown event type %q", ev)
+		}
+	}
+	return nil
+}
+
+/* ------------ Emitting & delivery ------------ */
+
+// emitEvent stores the event and queues one delivery per subscribed active
+// endpoint. Errors are logged only: a webhook must never fail the request.
+func (h *Handler) emitEvent(eventType string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("webhook: %s: %v", eventType, err)
+		return
+	}
+	_, err = h.DB.Exec(`
+		WITH ev AS (
+			INSERT INTO webhook_events (type, payload) VALUES ($1, $2::jsonb)
+			RETURNING id
+		)
+		INSERT INTO webhook_deliveries (endpoint_id, event_id)
+		SELECT we.id, ev.id
+		FROM webhook_endpoints we, ev
+		WHERE we.active
+		  AND (cardinality(we.events) = 0 OR $1 = ANY (we.events))`,
+		eventType, string(payload),
+	)
+	if err != nil {
+		log.Printf("webhook: %s: %v", eventType, err)
+	}
+}
+
+const (
+	maxWebhookAttempts  = 8
+	webhookPollInterval = 15 * time.Second
+)
+
+// webhookClient only connects to public addresses and doesn't follow
+// redirects (a 3xx counts as a failed delivery); localWebhookClient is
+// used in local mode, where receivers run on the dev machine.
+var (
+	webhookClient = &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: webhookDialControl}).DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	localWebhookClient = &http.Client{
+		Timeout:       10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+)
+
+const webhookClaimTimeout = 30 * time.Minute
+
+// StartWebhookWorker delivers pending webhook deliveries until ctx is done.
+func (h *Handler) StartWebhookWorker(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(webhookPollInterval)
+		defer t.Stop()
+		for {
+			if err := h.processWebhookQueue(ctx); err != nil {
+				log.Printf("webhook: queue: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// processWebhookQueue POSTs due deliveries. Non-2xx answers are retried with
+// exponential backoff (1 min … ~1 h) and marked failed after maxWebhookAttempts.
+//
+// Like the mail queue, deliveries are claimed (status 'sending') and
+// committed first and each result is written on its own: no transaction is
+// held open during HTTP calls, and a failed update can't roll back the log
+// of a delivery the receiver already got. Expired claims are retried.
+func (h *Handler) processWebhookQueue(ctx context.Context) error {
+	rows, err := h.DB.QueryContext(ctx, `
+		WITH claimed AS (
+			UPDATE webhook_deliveries d
+			SET status = 'sending',
+			    attempts = attempts + 1,
+			    next_attempt_at = now() + make_interval(secs => $1)
+			WHERE d.id IN (
+				SELECT d2.id
+				FROM webhook_deliveries d2
+				JOIN webhook_endpoints we ON we.id = d2.endpoint_id
+				WHERE d2.status IN ('pending','sending') AND d2.next_attempt_at <= now() AND we.active
+				ORDER BY d2.next_attempt_at, d2.id
+				LIMIT 20
+				FOR UPDATE OF d2 SKIP LOCKED
+			)
+			RETURNING d.id, d.attempts, d.endpoint_id, d.event_id
+		)
+		SELECT c.id, c.attempts, we.url, we.secret, e.id, e.type, e.payload,
+		       to_char(e.created_at, 'YYYY-MM-DD"T"HH24:MI:SSZ')
+		FROM claimed c
+		JOIN webhook_endpoints we ON we.id = c.endpoint_id
+		JOIN webhook_events e     ON e.id = c.event_id
+		ORDER BY c.id`, webhookClaimTimeout.Seconds())
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id, attempts           int // attempts including this one
+		url, secret, eventType string
+		eventID                int
+		payload                json.RawMessage
+		createdAt              string
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.attempts, &p.url, &p.secret, &p.eventID, &p.eventType, &p.payload, &p.createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	client := webhookClient
+	if h.isLocal() {
+		client = localWebhookClient
+	}
+	for _, p := range batch {
+		body, _ := json.Marshal(map[string]any{
+			"id":         p.eventID,
+			"type":       p.eventType,
+			"created_at": p.createdAt,
+			"data":       p.payload,
+		})
+		code, sendErr := deliverWebhook(ctx, client, p.url, p.secret, p.id, p.eventType, body)
+
+		if sendErr == nil {
+			_, err = h.DB.ExecContext(ctx, `
+				UPDATE webhook_deliveries
+				SET status = 'delivered', last_status_code = $1,
+				    last_error = NULL, delivered_at = now()
+				WHERE id = $2`, code, p.id)
+		} else {
+			status := "pending"
+			if p.attempts >= maxWebhookAttempts {
+				status = "failed"
+			}
+			var codePtr *int
+			if code != 0 {
+				codePtr = &code
+			}
+			_, err = h.DB.ExecContext(ctx, `
+				UPDATE webhook_deliveries
+				SET status = $1, last_status_code = $2, last_error = $3,
+				    next_attempt_at = now() + make_interval(mins => $4)
+				WHERE id = $5`, status, codePtr, sendErr.Error(), 1<<(p.attempts-1), p.id)
+		}
+		if err != nil {
+			// the claim expires and the delivery is retried
+			log.Printf("webhook: update delivery #%d: %v", p.id, err)
+		}
+	}
+	return nil
+}
+
+// deliverWebhook signs body like the session cookie (HMAC-SHA256, base64url)
+// over "<timestamp>.<body>" so receivers can reject replayed requests.
+func deliverWebhook(ctx context.Context, client *http.Client, target, secret string, deliveryID int, eventType string, body []byte) (int, error) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := hmacSign([]byte(secret), append([]byte(ts+"."), body...))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sales-assistant-webhooks/1")
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(deliveryID))
+	req.Header.Set("X-Webhook-Signature", "t="+ts+",v1="+sig)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS bank_statement_lines;
+DROP TABLE IF EXISTS bank_statement_imports;
+ALTER TABLE cashflow_entries DROP COLUMN IF EXISTS paid_date;
@@ -0,0 +1,31 @@
+-- ======================
+-- Bank statement import & payment matching
+-- ======================
+
+-- booking date of the payment that settled an entry
+ALTER TABLE cashflow_entries ADD COLUMN paid_date DATE;
+
+CREATE TABLE bank_statement_imports (
+    id SERIAL PRIMARY KEY,
+    filename TEXT,
+    format TEXT NOT NULL CHECK (format IN ('camt053','mt940','csv')),
+    imported_at TIMESTAMP DEFAULT now()
+);
+
+CREATE TABLE bank_statement_lines (
+    id SERIAL PRIMARY KEY,
+    import_id INT NOT NULL REFERENCES bank_statement_imports(id) ON DELETE CASCADE,
+    booking_date DATE NOT NULL,
+    amount NUMERIC NOT NULL,
+    currency TEXT,
+    counterparty_name TEXT,
+    counterparty_iban TEXT,
+    reference TEXT,
+    -- unmatched: needs manual assignment, matched: auto/manually assigned but not yet booked,
+    -- confirmed: entry set to paid, ignored: not a client payment
+    status TEXT NOT NULL CHECK (status IN ('unmatched','matched','confirmed','ignored')) DEFAULT 'unmatched',
+    cashflow_entry_id INT REFERENCES cashflow_entries(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_bank_statement_lines_import_id ON bank_statement_lines (import_id);
+CREATE INDEX IF NOT EXISTS idx_bank_statement_lines_entry_id  ON bank_statement_lines (cashflow_entry_id);
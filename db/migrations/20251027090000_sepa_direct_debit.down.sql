@@ -0,0 +1,20 @@
+DROP INDEX IF EXISTS idx_cashflow_entries_sepa_mandate_id;
+ALTER TABLE cashflow_entries
+    DROP COLUMN IF EXISTS sepa_iban,
+    DROP COLUMN IF EXISTS sepa_mandate_id,
+    DROP COLUMN IF EXISTS sepa_batch_id;
+
+UPDATE cashflow_entries SET status = 'pending' WHERE status = 'submitted';
+ALTER TABLE cashflow_entries DROP CONSTRAINT IF EXISTS cashflow_entries_status_check;
+ALTER TABLE cashflow_entries
+    ADD CONSTRAINT cashflow_entries_status_check
+    CHECK (status IN ('pending','paid','overdue'));
+
+DROP TABLE IF EXISTS sepa_batches;
+
+DROP INDEX IF EXISTS unique_sepa_mandate_id;
+ALTER TABLE clients
+    DROP COLUMN IF EXISTS sepa_iban,
+    DROP COLUMN IF EXISTS sepa_bic,
+    DROP COLUMN IF EXISTS sepa_mandate_id,
+    DROP COLUMN IF EXISTS sepa_mandate_signed_at;
@@ -0,0 +1,44 @@
+-- ======================
+-- SEPA direct debit (pain.008)
+-- ======================
+
+-- mandate data lives on the client (one active mandate per client)
+ALTER TABLE clients
+    ADD COLUMN sepa_iban TEXT,
+    ADD COLUMN sepa_bic TEXT,
+    ADD COLUMN sepa_mandate_id TEXT,
+    ADD COLUMN sepa_mandate_signed_at DATE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS unique_sepa_mandate_id
+    ON clients (sepa_mandate_id)
+    WHERE sepa_mandate_id IS NOT NULL;
+
+CREATE TABLE sepa_batches (
+    id SERIAL PRIMARY KEY,
+    message_id TEXT NOT NULL UNIQUE,
+    collection_date DATE NOT NULL,
+    period_from DATE NOT NULL,
+    period_to DATE NOT NULL,
+    number_of_transactions INT NOT NULL,
+    control_sum NUMERIC NOT NULL,
+    xml TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+-- 'submitted' = handed to the bank as direct debit, not yet booked as paid
+ALTER TABLE cashflow_entries DROP CONSTRAINT IF EXISTS cashflow_entries_status_check;
+ALTER TABLE cashflow_entries
+    ADD CONSTRAINT cashflow_entries_status_check
+    CHECK (status IN ('pending','submitted','paid','overdue'));
+
+-- the mandate and debtor IBAN each entry was collected under; a mandate's
+-- first collection (SeqTp FRST) is decided per mandate reference + IBAN
+ALTER TABLE cashflow_entries
+    ADD COLUMN sepa_batch_id INT REFERENCES sepa_batches(id) ON DELETE SET NULL,
+    ADD COLUMN sepa_mandate_id TEXT,
+    ADD COLUMN sepa_iban TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_cashflow_entries_sepa_batch_id ON cashflow_entries (sepa_batch_id);
+CREATE INDEX IF NOT EXISTS idx_cashflow_entries_sepa_mandate_id
+    ON cashflow_entries (sepa_mandate_id)
+    WHERE sepa_mandate_id IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS dunning_notices;
+ALTER TABLE cashflow_entries
+    DROP COLUMN IF EXISTS dunning_level,
+    DROP COLUMN IF EXISTS last_dunned_at;
@@ -0,0 +1,21 @@
+-- ======================
+-- Dunning (Zahlungserinnerung, 1. Mahnung, 2. Mahnung)
+-- ======================
+
+-- 0 = none, 1 = Zahlungserinnerung, 2 = 1. Mahnung, 3 = 2. Mahnung
+ALTER TABLE cashflow_entries
+    ADD COLUMN dunning_level INT NOT NULL DEFAULT 0 CHECK (dunning_level BETWEEN 0 AND 3),
+    ADD COLUMN last_dunned_at DATE;
+
+CREATE TABLE dunning_notices (
+    id SERIAL PRIMARY KEY,
+    cashflow_entry_id INT NOT NULL REFERENCES cashflow_entries(id) ON DELETE CASCADE,
+    level INT NOT NULL CHECK (level BETWEEN 1 AND 3),
+    fee NUMERIC NOT NULL DEFAULT 0 CHECK (fee >= 0),
+    pay_by DATE NOT NULL,
+    document TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT now(),
+    UNIQUE (cashflow_entry_id, level)
+);
+
+CREATE INDEX IF NOT EXISTS idx_dunning_notices_entry_id ON dunning_notices (cashflow_entry_id);
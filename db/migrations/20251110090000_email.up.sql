@@ -0,0 +1,71 @@
+-- ======================
+-- Outbound email: templates + queue
+-- ======================
+
+-- subject is a text/template, body_html an html/template
+CREATE TABLE email_templates (
+    key TEXT PRIMARY KEY,
+    description TEXT,
+    subject TEXT NOT NULL,
+    body_html TEXT NOT NULL,
+    updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE TABLE email_outbox (
+    id SERIAL PRIMARY KEY,
+    template_key TEXT NOT NULL,
+    to_address TEXT NOT NULL,
+    client_id INT REFERENCES clients(id) ON DELETE SET NULL,
+    subject TEXT NOT NULL,
+    body_html TEXT NOT NULL,
+    -- one mail per trigger occurrence, e.g. 'deal_won:12'
+    dedupe_key TEXT UNIQUE,
+    -- 'sending' = claimed by the mail worker; next_attempt_at is when the
+    -- claim expires and the mail is picked up again
+    status TEXT NOT NULL CHECK (status IN ('queued','sending','sent','failed')) DEFAULT 'queued',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT now(),
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT now(),
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_outbox_due       ON email_outbox (next_attempt_at) WHERE status IN ('queued','sending');
+CREATE INDEX IF NOT EXISTS idx_email_outbox_client_id ON email_outbox (client_id);
+
+INSERT INTO email_templates (key, description, subject, body_html) VALUES
+('zweitgespraech_reminder',
+ 'Sent to the client the day before the Zweitgespräch',
+ 'Erinnerung: unser Gespräch am {{.Date}}',
+ '<p>Hallo {{.ClientName}},</p>
+<p>ich freue mich auf unser Gespräch am <strong>{{.Date}}</strong>.</p>
+<p>Bis bald!</p>'),
+('deal_won',
+ 'Internal alert when a sales process is closed won',
+ 'Abschluss: {{.ClientName}} ({{.Revenue}} €)',
+ '<p>Neuer Abschluss mit <strong>{{.ClientName}}</strong>.</p>
+<ul>
+<li>Umsatz: {{.Revenue}} €</li>
+{{if .DurationMonths}}<li>Laufzeit: {{.DurationMonths}} Monate ({{.Frequency}})</li>{{end}}
+{{if .StartDate}}<li>Start: {{.StartDate}}</li>{{end}}
+</ul>'),
+('payment_reminder',
+ 'Sent to the client with each dunning notice',
+ '{{.Title}} – Vertrag Nr. {{.ContractID}}',
+ '<p>Hallo {{.ClientName}},</p>
+<p>die Rate über {{.Amount}} € (fällig seit {{.DueDate}}) ist noch offen.
+{{if .Fees}}Zzgl. Mahngebühren von {{.Fees}} €.{{end}}</p>
+<p>Bitte überweise den Betrag bis {{.PayBy}}.</p>
+<p>Falls die Zahlung bereits unterwegs ist, betrachte diese Nachricht bitte als gegenstandslos.</p>'),
+('weekly_summary',
+ 'Internal summary every Monday',
+ 'Wochenübersicht {{.Week}}',
+ '<h2>Wochenübersicht {{.Week}}</h2>
+<ul>
+<li>Neue Klienten: {{.NewClients}}</li>
+<li>Abschlüsse: {{.DealsWon}} ({{.RevenueWon}} €)</li>
+<li>Zahlungseingänge: {{.PaymentsReceived}} €</li>
+<li>Überfällige Raten: {{.OverdueCount}} ({{.OverdueAmount}} €)</li>
+<li>Zweitgespräche diese Woche: {{.UpcomingCalls}}</li>
+</ul>')
+ON CONFLICT (key) DO NOTHING;
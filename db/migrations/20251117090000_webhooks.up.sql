@@ -0,0 +1,41 @@
+-- ======================
+-- Outbound webhooks
+-- ======================
+
+CREATE TABLE webhook_endpoints (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    -- empty = all event types
+    events TEXT[] NOT NULL DEFAULT '{}',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE TABLE webhook_events (
+    id SERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE TABLE webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    endpoint_id INT NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id INT NOT NULL REFERENCES webhook_events(id) ON DELETE CASCADE,
+    -- 'sending' = claimed by the webhook worker; next_attempt_at is when
+    -- the claim expires and the delivery is picked up again
+    status TEXT NOT NULL CHECK (status IN ('pending','sending','delivered','failed')) DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT now(),
+    last_status_code INT,
+    last_error TEXT,
+    -- set when this delivery is a manual replay of another one
+    replay_of INT REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT now(),
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due         ON webhook_deliveries (next_attempt_at) WHERE status IN ('pending','sending');
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_id ON webhook_deliveries (endpoint_id);
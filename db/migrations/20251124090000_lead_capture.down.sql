@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_stage_participants_email_lower;
+DROP INDEX IF EXISTS idx_clients_email_lower;
+DROP TABLE IF EXISTS lead_submissions;
+DROP INDEX IF EXISTS stages_slug_uidx;
+ALTER TABLE stages DROP COLUMN IF EXISTS slug;
@@ -0,0 +1,26 @@
+-- ======================
+-- Inbound lead capture
+-- ======================
+
+-- URL-friendly stage identifier for form builders (?stage=webinar-oktober-3)
+ALTER TABLE stages ADD COLUMN slug TEXT;
+
+UPDATE stages
+SET slug = trim(both '-' from lower(regexp_replace(name, '[^a-zA-Z0-9]+', '-', 'g'))) || '-' || id
+WHERE slug IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS stages_slug_uidx ON stages (slug);
+
+-- one row per processed submission; a resubmission replays the stored response
+CREATE TABLE lead_submissions (
+    submission_id TEXT PRIMARY KEY,
+    result TEXT NOT NULL CHECK (result IN ('participant','sales_process')),
+    client_id INT REFERENCES clients(id) ON DELETE SET NULL,
+    participant_id INT REFERENCES stage_participants(id) ON DELETE SET NULL,
+    sales_process_id INT REFERENCES sales_process(id) ON DELETE SET NULL,
+    response JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_clients_email_lower            ON clients (lower(email));
+CREATE INDEX IF NOT EXISTS idx_stage_participants_email_lower ON stage_participants (stage_id, lower(lead_email));
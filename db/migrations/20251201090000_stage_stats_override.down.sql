@@ -0,0 +1 @@
+ALTER TABLE stages DROP COLUMN IF EXISTS stats_override;
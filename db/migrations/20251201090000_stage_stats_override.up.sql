@@ -0,0 +1,13 @@
+-- ======================
+-- Stage counters
+-- ======================
+
+-- registrations/participants are derived from stage_participants unless
+-- stats_override is set (events where only aggregate numbers are known)
+ALTER TABLE stages ADD COLUMN stats_override BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- keep hand-maintained numbers of stages without participant rows
+UPDATE stages s
+SET stats_override = TRUE
+WHERE (s.registrations IS NOT NULL OR s.participants IS NOT NULL)
+  AND NOT EXISTS (SELECT 1 FROM stage_participants p WHERE p.stage_id = s.id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ad_spend_entries;
+DROP TABLE IF EXISTS ad_spend_imports;
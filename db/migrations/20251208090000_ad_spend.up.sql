@@ -0,0 +1,29 @@
+-- ======================
+-- Ad spend ledger
+-- ======================
+
+CREATE TABLE ad_spend_imports (
+    id SERIAL PRIMARY KEY,
+    filename TEXT,
+    channel TEXT NOT NULL,
+    rows INT NOT NULL DEFAULT 0,
+    imported_at TIMESTAMP DEFAULT now()
+);
+
+CREATE TABLE ad_spend_entries (
+    id SERIAL PRIMARY KEY,
+    stage_id INT REFERENCES stages(id) ON DELETE SET NULL,
+    channel TEXT NOT NULL CHECK (channel <> ''),   -- meta | google | youtube | ...
+    spend_date DATE NOT NULL,
+    amount NUMERIC NOT NULL CHECK (amount >= 0),
+    campaign TEXT,
+    import_id INT REFERENCES ad_spend_imports(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+-- one row per stage/channel/day/campaign; re-importing an export overwrites
+CREATE UNIQUE INDEX IF NOT EXISTS ad_spend_entries_uidx
+    ON ad_spend_entries (channel, spend_date, (COALESCE(campaign, '')), (COALESCE(stage_id, 0)));
+
+CREATE INDEX IF NOT EXISTS idx_ad_spend_entries_stage_id   ON ad_spend_entries (stage_id);
+CREATE INDEX IF NOT EXISTS idx_ad_spend_entries_spend_date ON ad_spend_entries (spend_date);
@@ -0,0 +1,21 @@
+-- ======================
+-- Expenses
+-- ======================
+
+-- recurrence 'none' = one-off on start_date; otherwise every interval from
+-- start_date until end_date (open-ended when NULL)
+CREATE TABLE expenses (
+    id SERIAL PRIMARY KEY,
+    description TEXT NOT NULL,
+    category TEXT,                      -- tools | staff | rent | ...
+    amount NUMERIC NOT NULL CHECK (amount >= 0),
+    recurrence TEXT NOT NULL DEFAULT 'none'
+        CHECK (recurrence IN ('none','monthly','quarterly','yearly')),
+    start_date DATE NOT NULL,
+    end_date DATE,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT now(),
+    CHECK (end_date IS NULL OR end_date >= start_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_expenses_start_date ON expenses (start_date);
@@ -0,0 +1,17 @@
+-- ======================
+-- Users & roles
+-- ======================
+
+-- admin:      everything, incl. settings, users, webhooks, email
+-- sales:      clients, sales pipeline, stages; finance read-only
+-- bookkeeper: finance (contracts, payments, SEPA, dunning, expenses, ad spend)
+CREATE TABLE users (
+    id SERIAL PRIMARY KEY,
+    email TEXT NOT NULL,
+    name TEXT,
+    role TEXT NOT NULL DEFAULT 'sales' CHECK (role IN ('admin','sales','bookkeeper')),
+    created_at TIMESTAMP DEFAULT now(),
+    updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_uidx ON users (lower(email));
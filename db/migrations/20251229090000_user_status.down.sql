@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS sessions_revoked_at,
+    DROP COLUMN IF EXISTS last_login_at,
+    DROP COLUMN IF EXISTS invited_by,
+    DROP COLUMN IF EXISTS status;
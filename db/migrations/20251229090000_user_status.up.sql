@@ -0,0 +1,15 @@
+-- ======================
+-- User lifecycle (replaces ALLOWED_EMAILS)
+-- ======================
+
+-- invited:  may sign in; becomes active on first login
+-- active:   has signed in at least once
+-- disabled: sign-in refused, existing sessions rejected
+ALTER TABLE users
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'invited' CHECK (status IN ('invited','active','disabled')),
+    ADD COLUMN invited_by TEXT,
+    ADD COLUMN last_login_at TIMESTAMP,
+    ADD COLUMN sessions_revoked_at TIMESTAMP;
+
+-- everyone in users so far was created by a login or explicitly by an admin
+UPDATE users SET status = 'active';
@@ -0,0 +1,21 @@
+-- ======================
+-- Server-side sessions
+-- ======================
+
+-- The cookie only carries the signed id. A session ends when revoked, when
+-- idle for SESSION_IDLE_TIMEOUT or at expires_at (SESSION_MAX_AGE after login).
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_idx ON sessions (user_id) WHERE revoked_at IS NULL;
+
+-- superseded by revoking the session rows
+ALTER TABLE users DROP COLUMN IF EXISTS sessions_revoked_at;
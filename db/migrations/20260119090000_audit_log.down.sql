@@ -0,0 +1,3 @@
+DELETE FROM app_settings WHERE key = 'audit_retention_days';
+
+DROP TABLE IF EXISTS audit_log;
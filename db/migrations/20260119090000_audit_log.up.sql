@@ -0,0 +1,28 @@
+-- ======================
+-- Audit log
+-- ======================
+
+-- One row per successful mutating /api request. changes holds the
+-- per-field diff: {"field": {"before": ..., "after": ...}}.
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    actor_email TEXT,
+    ip TEXT,
+    method TEXT NOT NULL,
+    route TEXT NOT NULL,  -- route pattern, e.g. /api/clients/{id}
+    path TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    entity_type TEXT,
+    entity_id TEXT,
+    changes JSONB
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_idx ON audit_log (created_at);
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (lower(actor_email));
+
+-- days to keep audit entries, 0 = forever
+INSERT INTO app_settings (key, value_numeric)
+VALUES ('audit_retention_days', 365)
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,20 @@
+-- ======================
+-- Sign-in identities (issuer + subject) bound to users
+-- ======================
+
+-- A user is bound to the provider account of their first sign-in; later
+-- sign-ins through that provider must come from the same account, not
+-- just carry the same email.
+CREATE TABLE user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,   -- OIDC_PROVIDERS name, e.g. google
+    issuer TEXT NOT NULL,     -- iss, per tenant for multi-tenant issuers
+    subject TEXT NOT NULL,    -- sub
+    email TEXT,               -- email claim at binding time, informational
+    created_at TIMESTAMP DEFAULT now(),
+    last_login_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_identities_issuer_subject_uidx ON user_identities (issuer, subject);
+CREATE UNIQUE INDEX IF NOT EXISTS user_identities_user_provider_uidx ON user_identities (user_id, provider);